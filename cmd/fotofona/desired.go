@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/registry"
+	"k8s.io/client-go/kubernetes"
+)
+
+// readDesired - Build the sources of --source the way the controller does and read the host ips
+// and the entries it would publish for them once, the sources are stopped on return
+func readDesired(ctx context.Context, rs controller.RecordSet, clientset kubernetes.Interface) ([]string, []controller.Entry, error) {
+
+	inf, err := registry.NewSources(opts.Sources, &registry.Deps{
+		Options:   &opts,
+		Clientset: clientset,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go inf.Start(ctx)
+
+	return controller.DesiredEntries(ctx, rs, inf)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/sink"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Verify the changes are shown the way diff does
+func TestPrintDiff(t *testing.T) {
+
+	prefix := "/skydns/local/kubemaster/"
+
+	rs := controller.RecordSet{RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: controller.DefaultOwnerID}
+	stale := controller.BuildEntries(rs, []string{"10.0.0.1", "10.0.0.9", "10.0.0.3", "10.0.0.4", "10.0.0.5"})
+
+	changes := sink.DiffEntries(nil, stale[4:], controller.DefaultOwnerID)
+
+	var buf bytes.Buffer
+	if err := printDiff(&buf, outputTable, changes); err != nil {
+		t.Error(err.Error())
+	}
+	if expectedOut := "-  " + prefix + "x5  " + stale[4].Val + "\n"; buf.String() != expectedOut {
+		t.Errorf("Expected %q but got %q", expectedOut, buf.String())
+	}
+}
+
+// Verify diff, verify and doctor take the source flags and read the entries the controller publishes
+func TestReadDesiredSources(t *testing.T) {
+
+	saved := opts
+	defer func() { opts = saved }()
+
+	for _, c := range []*cobra.Command{diffCmd, verifyCmd, doctorCmd} {
+		for _, name := range []string{"source", "source-merge", "probe-port", "static-ips", "nodes-address-types"} {
+			if c.Flags().Lookup(name) == nil {
+				t.Errorf("%s has no --%s", c.Name(), name)
+			}
+		}
+	}
+
+	if err := diffCmd.Flags().Parse([]string{"--source", "static", "--static-ips", "10.0.0.2,10.0.0.1"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	rs := controller.RecordSet{RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: controller.DefaultOwnerID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hostips, entries, err := readDesired(ctx, rs, fake.NewSimpleClientset())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fmt.Sprint(hostips) != "[10.0.0.2 10.0.0.1]" {
+		t.Errorf("Expected the static host ips but got %v", hostips)
+	}
+	if expected := controller.BuildWeightedEntries(rs, hostips, nil); fmt.Sprint(entries) != fmt.Sprint(expected) {
+		t.Errorf("Expected the entries %v of the controller but got %v", expected, entries)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tweakmy/fotofona/registry"
+	"github.com/tweakmy/fotofona/sink"
+)
+
+// flagDiffOutput - Output format of the diff
+var flagDiffOutput *string
+
+func init() {
+	flagDiffOutput = diffCmd.Flags().StringP("output", "o", outputTable, "output format: table|json|yaml")
+	registry.AddSourceFlags(diffCmd.Flags(), &opts)
+
+	RootCmd.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show what the controller would change in etcd without writing anything",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		rs, err := opts.RecordSet()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		clientset, err := opts.KubeClient()
+		if err != nil {
+			return err
+		}
+
+		_, desired, err := readDesired(ctx, rs, clientset)
+		if err != nil {
+			return err
+		}
+
+		cli, err := opts.EtcdClient()
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+
+		current, err := sink.ReadEntries(ctx, cli, rs.Prefix())
+		if err != nil {
+			return err
+		}
+
+		changes := sink.DiffEntries(desired, current, rs.OwnerID)
+
+		return printDiff(cmd.OutOrStdout(), *flagDiffOutput, changes)
+	},
+}
+
+// printDiff - Show the changes the way diff does
+func printDiff(w io.Writer, format string, changes []sink.EntryChange) error {
+	return printOutput(w, format, changes, func(tw *tabwriter.Writer) {
+		for _, c := range changes {
+			moved := ""
+			if c.MovedFrom != "" {
+				moved = fmt.Sprintf(" (moved from %s, not owned)", c.MovedFrom)
+			}
+
+			switch c.Action {
+			case sink.ActionAdd:
+				fmt.Fprintf(tw, "+\t%s\t%s%s\n", c.Key, c.New, moved)
+			case sink.ActionRemove:
+				fmt.Fprintf(tw, "-\t%s\t%s\n", c.Key, c.Old)
+			case sink.ActionChange:
+				fmt.Fprintf(tw, "~\t%s\t%s -> %s%s\n", c.Key, c.Old, c.New, moved)
+			case sink.ActionConflict:
+				fmt.Fprintf(tw, "!\t%s\t%s (not owned, no free slot)\n", c.Key, c.Old)
+			default:
+				fmt.Fprintf(tw, " \t%s\t%s%s\n", c.Key, c.Old, moved)
+			}
+		}
+	})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/source"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkResult - Outcome of one preflight check
+type checkResult struct {
+	Name   string
+	OK     bool
+	Detail string
+	Hint   string
+}
+
+func pass(name string, format string, a ...interface{}) checkResult {
+	return checkResult{Name: name, OK: true, Detail: fmt.Sprintf(format, a...)}
+}
+
+func fail(name string, hint string, format string, a ...interface{}) checkResult {
+	return checkResult{Name: name, Detail: fmt.Sprintf(format, a...), Hint: hint}
+}
+
+// printChecks - One line per check, the remediation hint below every failure
+func printChecks(w io.Writer, results []checkResult) (failed int) {
+
+	for _, r := range results {
+		status := "PASS"
+		if !r.OK {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, r.Name, r.Detail)
+		if !r.OK && r.Hint != "" {
+			fmt.Fprintf(w, "       hint: %s\n", r.Hint)
+		}
+	}
+
+	return failed
+}
+
+// checkNodeAccess - The informer needs to list and watch the nodes
+func checkNodeAccess(clientset kubernetes.Interface) []checkResult {
+
+	results := []checkResult{}
+
+	for _, verb := range []string{"list", "watch"} {
+
+		name := "rbac nodes " + verb
+
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:     verb,
+					Resource: "nodes",
+				},
+			},
+		})
+
+		switch {
+		case err != nil:
+			results = append(results, fail(name,
+				"check --usekubeconfig/--kubeconfigpath or the service account token of the pod",
+				"could not reach the api server: %s", err.Error()))
+		case !review.Status.Allowed:
+			results = append(results, fail(name,
+				"bind a ClusterRole allowing get/list/watch on nodes to the service account",
+				"not allowed %s", review.Status.Reason))
+		default:
+			results = append(results, pass(name, "allowed"))
+		}
+	}
+
+	return results
+}
+
+// checkNodeSelector - Count the nodes matching the labels and how many are ready with one of the address types
+func checkNodeSelector(clientset kubernetes.Interface, watchLabels string, addressTypes []string) checkResult {
+
+	name := "label selector"
+
+	nodes, err := clientset.CoreV1().Nodes().List(metaV1.ListOptions{LabelSelector: watchLabels})
+	if err != nil {
+		return fail(name, "check --watchlabels is a valid label selector", "could not list nodes: %s", err.Error())
+	}
+
+	ready := 0
+	for i := range nodes.Items {
+		if _, isReady, err := source.NodeAddress(&nodes.Items[i], addressTypes); err == nil && isReady {
+			ready++
+		}
+	}
+
+	if len(nodes.Items) == 0 {
+		return fail(name, fmt.Sprintf("compare with: kubectl get nodes -l '%s'", watchLabels),
+			"no node matches %q", watchLabels)
+	}
+
+	if ready == 0 {
+		return fail(name, "nothing gets published until one of the nodes is Ready with one of --nodes-address-types "+strings.Join(addressTypes, ","),
+			"%d nodes match %q but none is ready", len(nodes.Items), watchLabels)
+	}
+
+	return pass(name, "%d nodes match %q, %d ready", len(nodes.Items), watchLabels, ready)
+}
+
+// checkSources - Read the host ips of --source once, the way the controller does
+func checkSources(ctx context.Context, rs controller.RecordSet, clientset kubernetes.Interface) checkResult {
+
+	name := "sources"
+
+	hostips, _, err := readDesired(ctx, rs, clientset)
+	if err != nil {
+		return fail(name, "check --source and the flags of every selected source", "%s", err.Error())
+	}
+
+	if len(hostips) == 0 {
+		return fail(name, "nothing gets published until one of --source has a host ip",
+			"%s has no host ip", strings.Join(opts.Sources, ","))
+	}
+
+	return pass(name, "%d host ips: %s", len(hostips), strings.Join(hostips, ", "))
+}
+
+// checkEtcd - Connect and make sure we are allowed to write under the domain
+func checkEtcd(ctx context.Context, cli *clientv3.Client, prefix string) []checkResult {
+
+	results := []checkResult{}
+
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return append(results, fail("etcd connectivity",
+			"check --endpoints, and --cacerts/--cert/--key/--insecure-skip-tls-verify for TLS",
+			"could not read %s: %s", prefix, err.Error()))
+	}
+	results = append(results, pass("etcd connectivity", "%d keys under %s", resp.Count, prefix))
+
+	//Etcd checks the permission of every operation in a transaction, even the branch never taken,
+	//so nothing ends up written where CoreDNS could read it
+	probe := prefix + "fotofona-doctor"
+	_, err = cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.Version(probe), "<", 0)).
+		Then(clientv3.OpPut(probe, "")).
+		Commit()
+	if err != nil {
+		return append(results, fail("etcd write permission",
+			fmt.Sprintf("grant the etcd user readwrite on the key prefix %s", prefix),
+			"not allowed to write under %s: %s", prefix, err.Error()))
+	}
+
+	return append(results, pass("etcd write permission", "allowed under %s", prefix))
+}
+
+// corefileEtcd - The etcd plugin settings of a server block
+type corefileEtcd struct {
+	Zones []string
+	Path  string
+}
+
+// parseCorefile - Pick the etcd plugin blocks out of a Corefile
+func parseCorefile(r io.Reader) ([]corefileEtcd, error) {
+
+	blocks := []corefileEtcd{}
+	var current *corefileEtcd
+	depth := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+
+		if current == nil && len(fields) > 0 && fields[0] == "etcd" {
+			etcd := corefileEtcd{Path: "/skydns"} //Default of the plugin
+			for _, zone := range fields[1:] {
+				if zone != "{" {
+					etcd.Zones = append(etcd.Zones, strings.TrimSuffix(zone, "."))
+				}
+			}
+			blocks = append(blocks, etcd)
+			current = &blocks[len(blocks)-1]
+			depth = 0
+		} else if current != nil && len(fields) > 1 && fields[0] == "path" && depth == 1 {
+			current.Path = fields[1]
+		}
+
+		if current != nil {
+			depth += strings.Count(line, "{") - strings.Count(line, "}")
+			if depth <= 0 {
+				current = nil
+			}
+		}
+	}
+
+	return blocks, scanner.Err()
+}
+
+// checkCorefile - CoreDNS has to read the same path and serve the zone of the domain
+func checkCorefile(r io.Reader, rootKey string, domainName string) checkResult {
+
+	name := "corefile"
+
+	blocks, err := parseCorefile(r)
+	if err != nil {
+		return fail(name, "", "could not read: %s", err.Error())
+	}
+
+	if len(blocks) == 0 {
+		return fail(name, "add the etcd plugin to the server block serving "+domainName, "no etcd plugin found")
+	}
+
+	root := "/" + strings.Trim(rootKey, "/")
+
+	for _, b := range blocks {
+
+		if "/"+strings.Trim(b.Path, "/") != root {
+			continue
+		}
+
+		for _, zone := range b.Zones {
+			if domainName == zone || strings.HasSuffix(domainName, "."+zone) {
+				return pass(name, "etcd plugin serves %s from %s", zone, b.Path)
+			}
+		}
+
+		return fail(name, fmt.Sprintf("add %s or one of its parents to the etcd plugin zones", domainName),
+			"etcd plugin reads %s but does not serve %s", b.Path, domainName)
+	}
+
+	return fail(name, fmt.Sprintf("set `path %s` in the etcd plugin or change --rootpath", root),
+		"no etcd plugin reads %s", root)
+}
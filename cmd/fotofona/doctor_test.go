@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testCorefile = `.:8053 {
+    etcd kubemaster.local {
+        stubzones
+        path /skydns
+        endpoint http://localhost:2378
+        upstream
+    }
+    prometheus
+    cache 160 skydns.local
+    loadbalance
+    bind 127.0.0.1
+    debug
+}
+`
+
+// Verify the etcd plugin settings are read out of the Corefile
+func TestDoctorParseCorefile(t *testing.T) {
+
+	blocks, err := parseCorefile(strings.NewReader(testCorefile))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if len(blocks) != 1 || blocks[0].Path != "/skydns" || len(blocks[0].Zones) != 1 || blocks[0].Zones[0] != "kubemaster.local" {
+		t.Errorf("Unexpected etcd plugin settings %v", blocks)
+	}
+
+	//The path defaults to /skydns when it is not set
+	blocks, _ = parseCorefile(strings.NewReader("example.org {\n  etcd cluster.local. {\n    endpoint http://localhost:2379\n  }\n}\n"))
+	if len(blocks) != 1 || blocks[0].Path != "/skydns" || blocks[0].Zones[0] != "cluster.local" {
+		t.Errorf("Unexpected etcd plugin settings %v", blocks)
+	}
+}
+
+// Verify the Corefile is checked against the flags
+func TestDoctorCheckCorefile(t *testing.T) {
+
+	testCases := []struct {
+		rootKey    string
+		domainName string
+		expected   bool
+	}{
+		{rootKey: "/skydns", domainName: "kubemaster.local", expected: true},
+		{rootKey: "skydns/", domainName: "kubemaster.local", expected: true},
+		{rootKey: "/coredns", domainName: "kubemaster.local", expected: false},
+		{rootKey: "/skydns", domainName: "api.kubemaster.local", expected: true},
+		{rootKey: "/skydns", domainName: "kubemaster.example", expected: false},
+	}
+
+	for i, tc := range testCases {
+		r := checkCorefile(strings.NewReader(testCorefile), tc.rootKey, tc.domainName)
+		if r.OK != tc.expected {
+			t.Errorf("test item %d expected %t but outcome %t: %s", i, tc.expected, r.OK, r.Detail)
+		}
+	}
+}
+
+// Verify the failed checks carry the hint
+func TestDoctorPrintChecks(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	failed := printChecks(&buf, []checkResult{
+		pass("etcd connectivity", "%d keys under %s", 2, "/skydns/local/kubemaster/"),
+		fail("label selector", "compare with: kubectl get nodes", "no node matches %q", "a=b"),
+	})
+
+	expected := `[PASS] etcd connectivity: 2 keys under /skydns/local/kubemaster/
+[FAIL] label selector: no node matches "a=b"
+       hint: compare with: kubectl get nodes
+`
+
+	if failed != 1 {
+		t.Errorf("Expected 1 failure but got %d", failed)
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, buf.String())
+	}
+}
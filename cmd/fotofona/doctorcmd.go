@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/registry"
+)
+
+// flagCorefile - Optional Corefile to check against --rootpath and --domainname
+var flagCorefile *string
+
+func init() {
+	flagCorefile = doctorCmd.Flags().StringP("corefile", "", "", "CoreDNS Corefile to check against --rootpath and --domainname")
+	registry.AddSourceFlags(doctorCmd.Flags(), &opts)
+
+	RootCmd.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the kubernetes access, the label selector, etcd and CoreDNS settings",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		results := []checkResult{}
+
+		rs, rsErr := opts.RecordSet()
+		if rsErr != nil {
+			results = append(results, fail("flags", "", "%s", rsErr.Error()))
+		} else {
+			results = append(results, pass("flags", "publishing %s under %s", rs.DomainName, rs.Prefix()))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		clientset, err := opts.KubeClient()
+		if err != nil {
+			results = append(results, fail("kubernetes client",
+				"check --usekubeconfig/--kubeconfigpath or run inside the cluster", "%s", err.Error()))
+		} else {
+			results = append(results, checkNodeAccess(clientset)...)
+			if hasName(opts.Sources, "nodes") {
+				results = append(results, checkNodeSelector(clientset, opts.WatchLabels, registry.NodesAddressTypes()))
+			}
+			if rsErr == nil {
+				results = append(results, checkSources(ctx, rs, clientset))
+			}
+		}
+
+		cli, err := opts.EtcdClient()
+		if err != nil {
+			results = append(results, fail("etcd client",
+				"check --endpoints and the TLS flags", "%s", err.Error()))
+		} else {
+			defer cli.Close()
+			results = append(results, checkEtcd(ctx, cli, controller.DomainPrefix(opts.RootPath, opts.DomainName))...)
+		}
+
+		if *flagCorefile != "" {
+			f, err := os.Open(*flagCorefile)
+			if err != nil {
+				results = append(results, fail("corefile", "check --corefile", "%s", err.Error()))
+			} else {
+				results = append(results, checkCorefile(f, opts.RootPath, opts.DomainName))
+				f.Close()
+			}
+		}
+
+		if failed := printChecks(cmd.OutOrStdout(), results); failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(results))
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"github.com/tweakmy/fotofona/sink"
+	"github.com/tweakmy/fotofona/source"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// waitForHosts - Poll the prefix until the published hosts match, return what was read
+func waitForHosts(t *testing.T, cli *clientv3.Client, rootKey string, prefix string, want []string) []PublishedRecord {
+	t.Helper()
+
+	var records []PublishedRecord
+	var hosts []string
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+
+		var err error
+		records, err = listRecords(context.Background(), cli, rootKey, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hosts = []string{}
+		for _, r := range records {
+			hosts = append(hosts, r.Host)
+		}
+		sort.Strings(hosts)
+
+		if reflect.DeepEqual(hosts, want) {
+			return records
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected the hosts %v under %s but got %v", want, prefix, hosts)
+	return nil
+}
+
+// Verify the node changes end up in etcd through the informer, the controller and the lease
+func TestEmbeddedEtcdPipeline(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+
+	node1 := testutil.NewMasterNode("node1", "10.0.0.1", "True")
+	node2 := testutil.NewMasterNode("node2", "10.0.0.2", "True")
+	worker := testutil.NewMasterNode("worker1", "10.0.1.1", "True")
+	worker.Labels = map[string]string{}
+
+	clientset := fake.NewSimpleClientset([]runtime.Object{node1, worker}...)
+
+	rs := controller.RecordSet{RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 10, OwnerID: controller.DefaultOwnerID}
+	prefix := rs.Prefix()
+
+	//Someone else's record under the same domain is left alone throughout
+	foreign := prefix + "x9"
+	if _, err := e.Client.Put(context.Background(), foreign, `{"host":"10.0.9.9","owner":"external-dns"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	lease := sink.NewEtcdLease(e.Client, rs.OwnerID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		controller.RunController(ctx, rs, lease, source.NewInformer("node-role.kubernetes.io/master=", clientset))
+	}()
+
+	records := waitForHosts(t, e.Client, rs.RootKey, prefix, []string{"10.0.0.1", "10.0.9.9"})
+
+	leaseID := lease.LeaseID()
+	for _, r := range records {
+		if r.Key == foreign {
+			if r.LeaseID != 0 {
+				t.Errorf("Expected the foreign key to stay without a lease, got %+v", r)
+			}
+			continue
+		}
+		if r.LeaseID != leaseID || r.LeaseTTL <= 0 || r.LeaseTTL > int64(rs.LeaseTime()) {
+			t.Errorf("Expected %s on lease %d with at most %ds left, got %+v", r.Key, leaseID, rs.LeaseTime(), r)
+		}
+	}
+
+	setReady := func(node *v1.Node, status v1.ConditionStatus) func() error {
+		return func() error {
+			updated := node.DeepCopy()
+			updated.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}
+			_, err := clientset.CoreV1().Nodes().Update(updated)
+			return err
+		}
+	}
+
+	steps := []struct {
+		name   string
+		change func() error
+		want   []string
+	}{
+		{
+			name:   "add",
+			change: func() error { _, err := clientset.CoreV1().Nodes().Create(node2); return err },
+			want:   []string{"10.0.0.1", "10.0.0.2", "10.0.9.9"},
+		},
+		{
+			name:   "not ready",
+			change: setReady(node1, v1.ConditionFalse),
+			want:   []string{"10.0.0.2", "10.0.9.9"},
+		},
+		{
+			name:   "ready again",
+			change: setReady(node1, v1.ConditionTrue),
+			want:   []string{"10.0.0.1", "10.0.0.2", "10.0.9.9"},
+		},
+		{
+			name:   "remove",
+			change: func() error { return clientset.CoreV1().Nodes().Delete(node2.Name, nil) },
+			want:   []string{"10.0.0.1", "10.0.9.9"},
+		},
+	}
+
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: %s", step.name, err.Error())
+		}
+
+		waitForHosts(t, e.Client, rs.RootKey, prefix, step.want)
+
+		//The lease is reused across the reconciles
+		if current := lease.LeaseID(); current != leaseID {
+			t.Errorf("%s: expected the lease %d to be reused but got %d", step.name, leaseID, current)
+		}
+	}
+
+	//What CoreDNS would answer out of the same etcd
+	server := startSkyDNSServer(t, rs.RootKey, func(ctx context.Context, prefix string) ([]controller.Entry, error) {
+		return sink.ReadEntries(ctx, e.Client, prefix)
+	})
+	defer server.Close()
+
+	ips, err := resolveHostIPs(context.Background(), newResolver(server.Addr()), rs.DomainName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := normalizeIPs(ips); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.9.9"}) {
+		t.Errorf("Expected dns to answer the ready node and the foreign record but got %v", got)
+	}
+
+	cancel()
+	<-done
+
+	//Revoking removes our entries and nothing else
+	if err := lease.RevokeLease(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitForHosts(t, e.Client, rs.RootKey, prefix, []string{"10.0.9.9"})
+
+	resp, err := e.Client.TimeToLive(context.Background(), clientv3.LeaseID(leaseID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TTL != -1 {
+		t.Errorf("Expected the lease %d to be revoked, %ds left", leaseID, resp.TTL)
+	}
+}
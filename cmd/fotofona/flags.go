@@ -0,0 +1,6 @@
+package main
+
+import "github.com/tweakmy/fotofona/config"
+
+// opts - Settings of the root command, shared by the subcommands
+var opts config.Options
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tweakmy/fotofona/config"
+	"github.com/tweakmy/fotofona/notify"
+)
+
+// flagHistoryOutput - Output format of the history
+var flagHistoryOutput *string
+
+// flagHistoryListLimit - Publications shown, newest first
+var flagHistoryListLimit *int
+
+func init() {
+	flagHistoryOutput = historyCmd.Flags().StringP("output", "o", outputTable, "output format: table|json|yaml")
+	flagHistoryListLimit = historyCmd.Flags().IntP("limit", "n", defaultHistoryListLimit, "publications shown, newest first; 0: all of them")
+
+	RootCmd.AddCommand(historyCmd)
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show which host ips were published for --domainname and when",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if err := config.ValidateHistoryPrefix(opts.HistoryPrefix, opts.RootPath); err != nil {
+			return err
+		}
+
+		cli, err := opts.EtcdClient()
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		history, err := notify.NewHistoryStore(cli, opts.HistoryPrefix, 0).List(ctx, opts.DomainName, *flagHistoryListLimit)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), *flagHistoryOutput, history, func(tw *tabwriter.Writer) {
+			fmt.Fprintln(tw, "TIME\tTRIGGER\tOLD\tNEW")
+			for _, p := range history {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+					p.Time.Format(time.RFC3339), p.Trigger, formatIPs(p.Old), formatIPs(p.New))
+			}
+		})
+	},
+}
+
+// formatIPs - Comma separated host ips, - when there is none
+func formatIPs(ips []string) string {
+	if len(ips) == 0 {
+		return "-"
+	}
+	return strings.Join(ips, ",")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tweakmy/fotofona/logging"
+	"github.com/tweakmy/fotofona/notify"
+	"github.com/tweakmy/fotofona/sink"
+	"go.uber.org/zap"
+)
+
+// defaultHistoryListLimit - Publications returned when the caller does not ask for a number
+const defaultHistoryListLimit = 20
+
+// newHTTPHandler - Expose the history of the domain, the readiness of the sinks and the expvar metrics
+func newHTTPHandler(history notify.HistoryReader, domain string, health *sink.SinkHealth) http.Handler {
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	if health != nil {
+		mux.HandleFunc("/readyz", readyHandler(health))
+	}
+
+	if history != nil {
+		mux.HandleFunc("/history", historyHandler(history, domain))
+	}
+
+	return mux
+}
+
+// historyHandler - Newest publications first as json, ?limit=0 returns all of them, ?domain= picks another domain
+func historyHandler(history notify.HistoryReader, defaultDomain string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		domain := defaultDomain
+		if v := r.URL.Query().Get("domain"); v != "" {
+			domain = v
+		}
+
+		limit := defaultHistoryListLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "limit: must be a positive number", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		list, err := history.List(ctx, domain, limit)
+		if err != nil {
+			logging.Logger(logging.ComponentCmd).Error("Could not read the history", zap.String("domain", domain), zap.Error(err))
+			http.Error(w, "could not read the history", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// readyHandler - Health of every sink as json, 503 unless the sinks are ready under the failure policy
+func readyHandler(health *sink.SinkHealth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		status := http.StatusOK
+		if !health.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(health.Status())
+	}
+}
+
+// serveHTTP - Serve the handler until the context is done
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
+
+	srv := &http.Server{Addr: addr, Handler: handler}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	logging.Logger(logging.ComponentCmd).Info("Serving http", zap.String("addr", addr))
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logging.Logger(logging.ComponentCmd).Error("Could not serve http", zap.String("addr", addr), zap.Error(err))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/sink"
+)
+
+type historyTest struct {
+	history []controller.Publication
+	err     error
+	limit   int
+}
+
+func (h *historyTest) List(ctx context.Context, domain string, limit int) ([]controller.Publication, error) {
+	h.limit = limit
+	return h.history, h.err
+}
+
+func TestHistoryHandler(t *testing.T) {
+
+	reader := &historyTest{
+		history: []controller.Publication{
+			{Time: time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC), Domain: "kubemaster.local", Trigger: controller.TriggerInformer,
+				Old: []string{"10.0.0.1"}, New: []string{"10.0.0.1", "10.0.0.2"}},
+		},
+	}
+
+	srv := httptest.NewServer(newHTTPHandler(reader, "kubemaster.local", sink.NewSinkHealth(sink.FailurePolicyIsolate, "etcd")))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/history?limit=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var got []controller.Publication
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, reader.history) || reader.limit != 5 {
+		t.Errorf("Expected %+v with limit 5 but got %+v with limit %d", reader.history, got, reader.limit)
+	}
+
+	for url, status := range map[string]int{
+		"/history?limit=x": http.StatusBadRequest,
+		"/debug/vars":      http.StatusOK,
+		"/readyz":          http.StatusOK,
+	} {
+		resp, err := http.Get(srv.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: expected status %d but got %d", url, status, resp.StatusCode)
+		}
+	}
+
+	reader.err = errors.New("etcdserver: request timed out")
+	resp, err = http.Get(srv.URL + "/history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || reader.limit != defaultHistoryListLimit {
+		t.Errorf("Expected status %d with limit %d but got %d with limit %d",
+			http.StatusInternalServerError, defaultHistoryListLimit, resp.StatusCode, reader.limit)
+	}
+}
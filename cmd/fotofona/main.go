@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/tweakmy/fotofona/config"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"github.com/tweakmy/fotofona/notify"
+	"github.com/tweakmy/fotofona/registry"
+	v1Api "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// func init() {
+// 	//Sets default for the glog for now
+
+// }
+
+func main() {
+
+	RootCmd.Run = func(cmd *cobra.Command, args []string) {
+
+		//Validate all the user input
+		rs, err := opts.RecordSet()
+		if err != nil {
+			logging.Logger(logging.ComponentCmd).Error("Invalid flags", zap.Error(err))
+			os.Exit(0)
+		}
+
+		//Wait for process kill signal
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		clientset, err := opts.KubeClient()
+		if err != nil {
+			logging.Logger(logging.ComponentCmd).Fatal("Could not connect to kubernetes", zap.Error(err))
+			os.Exit(1)
+		}
+
+		var eventObject *v1Api.ObjectReference
+		if opts.EventObject != "" {
+			ref, err := config.ParseEventObject(opts.EventObject)
+			if err != nil {
+				logging.Logger(logging.ComponentCmd).Error("Invalid flags", zap.Error(err))
+				os.Exit(0)
+			}
+			eventObject = config.ResolveEventObject(clientset, ref)
+		}
+
+		sinkNames, err := opts.SinkNames()
+		if err != nil {
+			logging.Logger(logging.ComponentCmd).Error("Invalid flags", zap.Error(err))
+			os.Exit(0)
+		}
+
+		deps := &registry.Deps{
+			Options:   &opts,
+			Clientset: clientset,
+		}
+
+		//Create the down stream leases, more than one sink are written to together
+		sinks, err := registry.NewSinks(sinkNames, deps)
+		if err != nil {
+			logging.Logger(logging.ComponentCmd).Fatal("Could not create the sinks", zap.Error(err))
+			os.Exit(1)
+		}
+
+		webhook, err := opts.Webhook()
+		if err != nil {
+			logging.Logger(logging.ComponentCmd).Error("Invalid flags", zap.Error(err))
+			os.Exit(0)
+		}
+
+		//Nothing is published in a dry run or by local sinks only, so there is no history, webhook or event either
+		publishing := !opts.DryRun && !sinks.Local
+
+		//Tell the nodes and our own pod what happened to the records, the sources are built after this
+		var recorder record.EventRecorder
+		if publishing {
+			var stopEvents func()
+			recorder, stopEvents = config.NewEventRecorder(clientset)
+			defer stopEvents()
+			deps.Recorder = recorder
+		}
+
+		var observers []controller.Observer
+		var history notify.HistoryReader
+		if publishing && opts.HistoryLimit > 0 && hasName(sinkNames, config.DefaultSink) {
+			if err := config.ValidateHistoryPrefix(opts.HistoryPrefix, rs.RootKey); err != nil {
+				logging.Logger(logging.ComponentCmd).Error("Invalid flags", zap.Error(err))
+				os.Exit(0)
+			}
+			cli, err := deps.EtcdClient()
+			if err != nil {
+				logging.Logger(logging.ComponentCmd).Fatal("Could not connect to etcd", zap.Error(err))
+				os.Exit(1)
+			}
+			store := notify.NewHistoryStore(cli, opts.HistoryPrefix, opts.HistoryLimit)
+			observers = append(observers, store)
+			history = store
+		}
+
+		if publishing && webhook != nil {
+			go webhook.Start(ctx)
+			observers = append(observers, webhook)
+		}
+
+		if opts.HTTPAddr != "" {
+			go serveHTTP(ctx, opts.HTTPAddr, newHTTPHandler(history, rs.DomainName, sinks.Health))
+		}
+
+		if opts.CRD {
+			dynClient, err := opts.DynamicClient()
+			if err != nil {
+				logging.Logger(logging.ComponentCmd).Fatal("Could not connect to kubernetes", zap.Error(err))
+				os.Exit(1)
+			}
+
+			//Every record gets the selected sources, merged and probed like without --crd
+			newSource, err := registry.NewRecordSources(opts.Sources, deps)
+			if err != nil {
+				logging.Logger(logging.ComponentCmd).Fatal("Could not create the source", zap.Error(err))
+				os.Exit(1)
+			}
+
+			recordSets := controller.NewRecordSetController(dynClient, clientset, rs, sinks.NewLease, recorder, observers)
+			recordSets.SetNewSource(newSource)
+			go recordSets.Run(ctx)
+		} else {
+			//The controller starts getting data right away
+			inf, err := registry.NewSources(opts.Sources, deps)
+			if err != nil {
+				logging.Logger(logging.ComponentCmd).Fatal("Could not create the source", zap.Error(err))
+				os.Exit(1)
+			}
+
+			ctrl := &controller.Controller{
+				RecordSet:   rs,
+				Lease:       sinks.NewLease(rs.OwnerID),
+				Informer:    inf,
+				Recorder:    recorder,
+				EventObject: eventObject,
+				Observers:   observers,
+			}
+
+			go ctrl.Run(ctx)
+		}
+		// Block until a signal is received.
+		<-c
+
+	}
+
+	CmdExecute()
+
+}
+
+// hasName - The source or the sink is one of the selected ones
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats supported by the subcommands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// printOutput - Render v in the requested format, table is drawn by the caller
+func printOutput(w io.Writer, format string, v interface{}, table func(tw *tabwriter.Writer)) error {
+
+	switch format {
+	case outputTable, "":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	case outputJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case outputYAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
+	return fmt.Errorf("-o: unknown output format %q, use one of table|json|yaml", format)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+)
+
+// PurgeReport - What was removed from etcd, what was left alone and what changed under our feet
+type PurgeReport struct {
+	Keys    []string `json:"keys"`
+	Leases  []int64  `json:"leases"`
+	Skipped []string `json:"skipped,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// selectPurge - Pick the keys to be removed, only ours unless forced
+func selectPurge(kvs []*mvccpb.KeyValue, ownerID string, force bool) (selected []*mvccpb.KeyValue, skipped []string) {
+
+	for _, kv := range kvs {
+		if force || controller.IsOwnedBy(kv.Value, ownerID) {
+			selected = append(selected, kv)
+			continue
+		}
+		skipped = append(skipped, string(kv.Key))
+	}
+
+	return
+}
+
+// purgeKeys - Revoke the leases held only by the selected keys and delete the keys
+func purgeKeys(ctx context.Context, cli *clientv3.Client, selected []*mvccpb.KeyValue) (PurgeReport, error) {
+
+	report := PurgeReport{Keys: []string{}, Leases: []int64{}}
+
+	purged := make(map[string]struct{}, len(selected))
+	leases := map[int64]struct{}{}
+	for _, kv := range selected {
+		purged[string(kv.Key)] = struct{}{}
+		if kv.Lease != 0 {
+			leases[kv.Lease] = struct{}{}
+		}
+	}
+
+	revoked := map[int64]struct{}{}
+	for leaseID := range leases {
+
+		ttlresp, err := cli.TimeToLive(ctx, clientv3.LeaseID(leaseID), clientv3.WithAttachedKeys())
+		if err != nil {
+			return report, err
+		}
+
+		//Revoking takes every attached key along, keep the lease when it holds anything else
+		shared := false
+		for _, key := range ttlresp.Keys {
+			if _, ok := purged[string(key)]; !ok {
+				shared = true
+				break
+			}
+		}
+
+		if shared {
+			logging.Logger(logging.ComponentEtcd).Info("Lease is shared with other keys, not revoking it", zap.Int64("leaseID", int64(leaseID)))
+			continue
+		}
+
+		if _, err := cli.Revoke(ctx, clientv3.LeaseID(leaseID)); err != nil {
+			return report, err
+		}
+		report.Leases = append(report.Leases, leaseID)
+		revoked[leaseID] = struct{}{}
+	}
+
+	for _, kv := range selected {
+
+		//A revoked lease already took the key along
+		if _, ok := revoked[kv.Lease]; ok {
+			report.Keys = append(report.Keys, string(kv.Key))
+			continue
+		}
+
+		//Only delete when nobody has touched the key since we read it
+		txnResp, err := cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)).
+			Then(clientv3.OpDelete(string(kv.Key))).
+			Commit()
+		if err != nil {
+			return report, err
+		}
+		if !txnResp.Succeeded {
+			report.Changed = append(report.Changed, string(kv.Key))
+			continue
+		}
+		report.Keys = append(report.Keys, string(kv.Key))
+	}
+
+	sort.Strings(report.Keys)
+	sort.Strings(report.Changed)
+
+	return report, nil
+}
+
+// confirm - Ask the question until the user answers, anything but yes is a no
+func confirm(r io.Reader, w io.Writer, question string) bool {
+
+	fmt.Fprintf(w, "%s [y/N]: ", question)
+
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+)
+
+// Verify only our keys are purged unless forced
+func TestPurgeSelect(t *testing.T) {
+
+	kvs := []*mvccpb.KeyValue{
+		&mvccpb.KeyValue{Key: []byte("/skydns/local/kubemaster/x1"), Value: []byte(controller.Record{Host: "10.0.0.1", Owner: controller.DefaultOwnerID}.String())},
+		&mvccpb.KeyValue{Key: []byte("/skydns/local/kubemaster/x2"), Value: []byte(controller.Record{Host: "10.0.0.2", Owner: "external-dns"}.String())},
+		&mvccpb.KeyValue{Key: []byte("/skydns/local/kubemaster/manual"), Value: []byte(`{"host":"10.0.0.3"}`)},
+	}
+
+	selected, skipped := selectPurge(kvs, controller.DefaultOwnerID, false)
+	if len(selected) != 1 || string(selected[0].Key) != "/skydns/local/kubemaster/x1" {
+		t.Errorf("Expected only our key to be selected but got %v", selected)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("Expected 2 keys to be skipped but got %v", skipped)
+	}
+
+	selected, skipped = selectPurge(kvs, controller.DefaultOwnerID, true)
+	if len(selected) != 3 || len(skipped) != 0 {
+		t.Errorf("Expected every key to be selected when forced but got %v, skipped %v", selected, skipped)
+	}
+}
+
+// Verify the confirmation prompt
+func TestPurgeConfirm(t *testing.T) {
+
+	testCases := []struct {
+		answer   string
+		expected bool
+	}{
+		{answer: "y\n", expected: true},
+		{answer: "YES\n", expected: true},
+		{answer: "n\n", expected: false},
+		{answer: "\n", expected: false},
+		{answer: "", expected: false},
+	}
+
+	for i, tc := range testCases {
+		var out bytes.Buffer
+		if outcome := confirm(strings.NewReader(tc.answer), &out, "Remove?"); outcome != tc.expected {
+			t.Errorf("test item %d expected %t but outcome %t", i, tc.expected, outcome)
+		}
+		if out.String() != "Remove? [y/N]: " {
+			t.Errorf("test item %d unexpected prompt %q", i, out.String())
+		}
+	}
+}
+
+// Verify the keys changed since they were read are reported and left alone
+func TestPurgeKeys(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+
+	ctx := context.Background()
+	prefix := "/skydns/local/kubemaster/"
+	ours := controller.Record{Host: "10.0.0.1", Owner: controller.DefaultOwnerID}.String()
+
+	lease, err := e.Client.Grant(ctx, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Client.Put(ctx, prefix+"x1", ours, clientv3.WithLease(lease.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Client.Put(ctx, prefix+"x2", ours); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Client.Put(ctx, prefix+"x3", ours); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := e.Client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Someone rewrites x3 between the read and the purge
+	if _, err := e.Client.Put(ctx, prefix+"x3", `{"host":"10.0.0.3","owner":"external-dns"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := purgeKeys(ctx, e.Client, resp.Kvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(report.Keys, []string{prefix + "x1", prefix + "x2"}) {
+		t.Errorf("Expected x1 and x2 to be removed but got %v", report.Keys)
+	}
+	if !reflect.DeepEqual(report.Leases, []int64{int64(lease.ID)}) {
+		t.Errorf("Expected the lease %d to be revoked but got %v", lease.ID, report.Leases)
+	}
+	if !reflect.DeepEqual(report.Changed, []string{prefix + "x3"}) {
+		t.Errorf("Expected x3 to be reported as changed but got %v", report.Changed)
+	}
+
+	left, err := e.Client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left.Kvs) != 1 || string(left.Kvs[0].Key) != prefix+"x3" {
+		t.Errorf("Expected only x3 to be left but got %v", left.Kvs)
+	}
+}
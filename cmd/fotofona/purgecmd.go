@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// flagPurgeForce - Remove the keys of other owners as well
+	flagPurgeForce *bool
+
+	// flagPurgeYes - Do not ask for confirmation
+	flagPurgeYes *bool
+
+	// flagPurgeOutput - Output format of the report
+	flagPurgeOutput *string
+)
+
+func init() {
+	flagPurgeForce = purgeCmd.Flags().BoolP("force", "", false, "remove every key under the domain, including the ones not owned by --owner-id")
+	flagPurgeYes = purgeCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation")
+	flagPurgeOutput = purgeCmd.Flags().StringP("output", "o", outputTable, "output format: table|json|yaml")
+
+	RootCmd.AddCommand(purgeCmd)
+}
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Remove the records of --domainname and revoke their leases",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		rs, err := opts.RecordSet()
+		if err != nil {
+			return err
+		}
+
+		cli, err := opts.EtcdClient()
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+
+		readCtx, cancelRead := context.WithTimeout(context.Background(), 30*time.Second)
+		resp, err := cli.Get(readCtx, rs.Prefix(), clientv3.WithPrefix())
+		cancelRead()
+		if err != nil {
+			return err
+		}
+
+		selected, skipped := selectPurge(resp.Kvs, rs.OwnerID, *flagPurgeForce)
+
+		//Only the report goes to stdout, it has to parse with -o json or yaml
+		out, msg := cmd.OutOrStdout(), cmd.OutOrStderr()
+
+		for _, key := range skipped {
+			fmt.Fprintf(msg, "Skipping %s: not owned by %s, use --force to remove it\n", key, rs.OwnerID)
+		}
+
+		if len(selected) == 0 {
+			fmt.Fprintf(msg, "Nothing to purge under %s\n", rs.Prefix())
+			return nil
+		}
+
+		if !*flagPurgeYes {
+			for _, kv := range selected {
+				fmt.Fprintf(msg, "  %s\n", kv.Key)
+			}
+			if !confirm(os.Stdin, msg, fmt.Sprintf("Remove %d keys under %s?", len(selected), rs.Prefix())) {
+				fmt.Fprintln(msg, "Aborted")
+				return nil
+			}
+		}
+
+		//The time spent answering does not count against the purge
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		report, err := purgeKeys(ctx, cli, selected)
+		report.Skipped = skipped
+		if err != nil {
+			return err
+		}
+
+		return printOutput(out, *flagPurgeOutput, report, func(tw *tabwriter.Writer) {
+			for _, key := range report.Keys {
+				fmt.Fprintf(tw, "removed\t%s\n", key)
+			}
+			for _, leaseID := range report.Leases {
+				fmt.Fprintf(tw, "revoked\tlease %x\n", leaseID)
+			}
+			for _, key := range report.Changed {
+				fmt.Fprintf(tw, "changed\t%s\n", key)
+			}
+			for _, key := range report.Skipped {
+				fmt.Fprintf(tw, "skipped\t%s\n", key)
+			}
+		})
+	},
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/sink"
+)
+
+// PublishedRecord - Entry read back from etcd
+type PublishedRecord struct {
+	Key       string `json:"key"`
+	Name      string `json:"name"`
+	Host      string `json:"host,omitempty"`
+	TTL       int    `json:"ttl"`
+	Owner     string `json:"owner,omitempty"`
+	RecordSet string `json:"recordset,omitempty"`
+
+	//Raw - The value as it is stored when it is not a SkyDNS record
+	Raw string `json:"raw,omitempty"`
+
+	//LeaseID - 0 when the key is not attached to a lease
+	LeaseID int64 `json:"leaseID"`
+
+	//LeaseTTL - Seconds left on the lease, -1 when there is none
+	LeaseTTL int64 `json:"leaseTTL"`
+}
+
+// listRecords - Read every entry under the prefix along with its lease
+func listRecords(ctx context.Context, cli *clientv3.Client, rootKey string, prefix string) ([]PublishedRecord, error) {
+
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	//Most of the keys share the same lease
+	remaining := map[int64]int64{}
+
+	records := make([]PublishedRecord, 0, len(resp.Kvs))
+
+	for _, kv := range resp.Kvs {
+
+		rec := PublishedRecord{
+			Key:      string(kv.Key),
+			Name:     controller.KeyToDomain(rootKey, string(kv.Key)),
+			LeaseID:  kv.Lease,
+			LeaseTTL: -1,
+		}
+
+		if r, err := controller.DecodeRecord(kv.Value); err == nil {
+			rec.Host = r.Host
+			rec.TTL = r.TTL
+			rec.Owner = r.Owner
+			rec.RecordSet = r.RecordSet
+		} else {
+			rec.Raw = string(kv.Value)
+		}
+
+		if kv.Lease != 0 {
+			ttl, ok := remaining[kv.Lease]
+			if !ok {
+				ttl, err = sink.LeaseRemaining(ctx, cli, clientv3.LeaseID(kv.Lease))
+				if err != nil {
+					return nil, err
+				}
+				remaining[kv.Lease] = ttl
+			}
+			rec.LeaseTTL = ttl
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
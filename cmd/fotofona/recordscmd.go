@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tweakmy/fotofona/controller"
+)
+
+// flagOutput - Output format of the records list
+var flagOutput *string
+
+func init() {
+	flagOutput = recordsListCmd.Flags().StringP("output", "o", outputTable, "output format: table|json|yaml")
+
+	recordsCmd.AddCommand(recordsListCmd)
+	RootCmd.AddCommand(recordsCmd)
+}
+
+var recordsCmd = &cobra.Command{
+	Use:   "records",
+	Short: "Inspect the records published in etcd",
+}
+
+var recordsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the records published under --rootpath for --domainname",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		cli, err := opts.EtcdClient()
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		prefix := controller.DomainPrefix(opts.RootPath, opts.DomainName)
+
+		records, err := listRecords(ctx, cli, opts.RootPath, prefix)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(cmd.OutOrStdout(), *flagOutput, records, func(tw *tabwriter.Writer) {
+			fmt.Fprintln(tw, "NAME\tHOST\tTTL\tOWNER\tRECORDSET\tLEASE\tREMAINING\tKEY")
+			for _, r := range records {
+				host := r.Host
+				if host == "" {
+					host = r.Raw
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%x\t%s\t%s\n",
+					r.Name, host, r.TTL, r.Owner, r.RecordSet, r.LeaseID, formatRemaining(r.LeaseTTL), r.Key)
+			}
+		})
+	},
+}
+
+// formatRemaining - Human friendly remaining lease time
+func formatRemaining(ttl int64) string {
+	if ttl < 0 {
+		return "-"
+	}
+	return (time.Duration(ttl) * time.Second).String()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tweakmy/fotofona/controller"
+	"testing"
+	"text/tabwriter"
+)
+
+// Verify the key is translated back into the dns name
+func TestRecordsKeyToDomain(t *testing.T) {
+
+	testCases := []struct {
+		rootKey  string
+		key      string
+		expected string
+	}{
+		{rootKey: "/skydns", key: "/skydns/local/kubemaster/x1", expected: "x1.kubemaster.local"},
+		{rootKey: "skydns/", key: "/skydns/local/kubemaster/x2", expected: "x2.kubemaster.local"},
+		{rootKey: "/skydns", key: "/skydns/local/kubemaster", expected: "kubemaster.local"},
+	}
+
+	for i, tc := range testCases {
+		if outcome := controller.KeyToDomain(tc.rootKey, tc.key); outcome != tc.expected {
+			t.Errorf("test item %d expected %s but outcome %s", i, tc.expected, outcome)
+		}
+	}
+
+	//Round trip with the prefix we write to
+	prefix := controller.DomainPrefix("/skydns", "kubemaster.local")
+	if outcome := controller.KeyToDomain("/skydns", prefix+"x1"); outcome != "x1.kubemaster.local" {
+		t.Errorf("Expected the prefix to round trip but got %s", outcome)
+	}
+}
+
+// Verify the output formats
+func TestRecordsPrintOutput(t *testing.T) {
+
+	records := []PublishedRecord{
+		PublishedRecord{Key: "/skydns/local/kubemaster/x1", Name: "x1.kubemaster.local", Host: "10.0.0.1", TTL: 60, LeaseID: 1, LeaseTTL: 25},
+	}
+
+	table := func(tw *tabwriter.Writer) {
+		for _, r := range records {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Host, formatRemaining(r.LeaseTTL))
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := printOutput(&buf, outputTable, records, table); err != nil {
+		t.Error(err.Error())
+	}
+	if expected := "x1.kubemaster.local  10.0.0.1  25s\n"; buf.String() != expected {
+		t.Errorf("Expected table %q but got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := printOutput(&buf, outputJSON, records, table); err != nil {
+		t.Error(err.Error())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"leaseTTL": 25`)) {
+		t.Errorf("Expected the json to carry the lease ttl but got %s", buf.String())
+	}
+
+	if err := printOutput(&buf, "xml", records, table); err == nil {
+		t.Error("Expected an unknown format to be refused")
+	}
+}
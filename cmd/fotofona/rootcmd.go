@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/tweakmy/fotofona/logging"
+	"github.com/tweakmy/fotofona/registry"
+	"go.uber.org/zap"
+)
+
+func init() {
+
+	// Here you will define your flags and configuration settings.
+	opts.AddPersistentFlags(RootCmd.PersistentFlags())
+	registry.AddPersistentFlags(RootCmd.PersistentFlags(), &opts)
+	opts.AddFlags(RootCmd.Flags())
+	registry.AddFlags(RootCmd.Flags(), &opts)
+
+	//Add the glog flag
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	flag.CommandLine.Parse([]string{})
+
+}
+
+//RootCmd - Base command
+var RootCmd = &cobra.Command{
+	Use:   "fotofona",
+	Short: "Fotofona - Kubernetes Master DNS Server for Kube client",
+	Long:  `Exposed Kubernetes Master(s) via DNS`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return logging.Setup(opts.LogFormat)
+	},
+}
+
+// CmdExecute - Run Cobra Main here
+func CmdExecute() {
+	if err := RootCmd.Execute(); err != nil {
+		logging.Logger(logging.ComponentCmd).Error("Command error", zap.Error(err))
+		os.Exit(1)
+	}
+}
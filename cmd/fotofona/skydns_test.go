@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"github.com/tweakmy/fotofona/sink"
+	"github.com/tweakmy/fotofona/source"
+	"golang.org/x/net/dns/dnsmessage"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// skydnsDefaultTTL - TTL of the answer when the value does not carry one, like the CoreDNS etcd plugin
+const skydnsDefaultTTL = 300
+
+// entrySource - Read the entries under a prefix, from a MemoryStore or from etcd
+type entrySource func(ctx context.Context, prefix string) ([]controller.Entry, error)
+
+// skydnsService - The fields of the SkyDNS value CoreDNS reads to answer A and AAAA
+type skydnsService struct {
+	Host string `json:"host"`
+	TTL  uint32 `json:"ttl"`
+}
+
+// skydnsServer - Answer A and AAAA queries in process out of the SkyDNS entries,
+// following the CoreDNS etcd plugin instead of the code writing them
+type skydnsServer struct {
+	rootKey string
+	source  entrySource
+	conn    net.PacketConn
+}
+
+// startSkyDNSServer - Serve dns over udp on a random local port until Close
+func startSkyDNSServer(t *testing.T, rootKey string, source entrySource) *skydnsServer {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &skydnsServer{rootKey: rootKey, source: source, conn: conn}
+	go s.serve()
+
+	return s
+}
+
+// Addr - host:port to send the queries to
+func (s *skydnsServer) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close - Stop answering
+func (s *skydnsServer) Close() {
+	s.conn.Close()
+}
+
+func (s *skydnsServer) serve() {
+
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		resp, err := s.answer(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(resp, addr)
+	}
+}
+
+// answer - Build the response to a single question
+func (s *skydnsServer) answer(req []byte) ([]byte, error) {
+
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	rh := dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RecursionDesired: h.RecursionDesired}
+
+	services, err := s.lookup(context.Background(), q.Name.String())
+	switch {
+	case err != nil:
+		rh.RCode = dnsmessage.RCodeServerFailure
+	case len(services) == 0:
+		rh.RCode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, rh)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	for _, svc := range services {
+
+		ip := net.ParseIP(svc.Host)
+		if ip == nil {
+			//CoreDNS answers a CNAME, there is none of those among the node addresses
+			continue
+		}
+
+		header := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: svc.TTL}
+
+		switch ip4 := ip.To4(); {
+		case q.Type == dnsmessage.TypeA && ip4 != nil:
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			err = b.AResource(header, a)
+		case q.Type == dnsmessage.TypeAAAA && ip4 == nil:
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip.To16())
+			err = b.AAAAResource(header, aaaa)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Finish()
+}
+
+// lookup - Services of the name, the key of the name itself or every key below it
+func (s *skydnsServer) lookup(ctx context.Context, name string) ([]skydnsService, error) {
+
+	key := skydnsPath(s.rootKey, name)
+
+	entries, err := s.source(ctx, key+"/")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		if entries, err = s.source(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[string]struct{}{}
+	var services []skydnsService
+
+	for _, entry := range entries {
+
+		//The exact lookup reads the siblings sharing the prefix as well
+		if entry.Key != key && !strings.HasPrefix(entry.Key, key+"/") {
+			continue
+		}
+
+		var svc skydnsService
+		if err := json.Unmarshal([]byte(entry.Val), &svc); err != nil {
+			return nil, err
+		}
+		if svc.TTL == 0 {
+			svc.TTL = skydnsDefaultTTL
+		}
+
+		//The same host under several keys is answered once
+		if _, ok := seen[svc.Host]; ok {
+			continue
+		}
+		seen[svc.Host] = struct{}{}
+
+		services = append(services, svc)
+	}
+
+	return services, nil
+}
+
+// skydnsPath - Key of the name, the labels reversed under the root, like msg.Path of CoreDNS
+func skydnsPath(rootKey string, name string) string {
+
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	return path.Join(append([]string{"/", rootKey}, labels...)...)
+}
+
+// skydnsAnswer - One address record of the response
+type skydnsAnswer struct {
+	IP  string
+	TTL uint32
+}
+
+// querySkyDNS - Send a single question like dig would, return the rcode and the answers
+func querySkyDNS(t *testing.T, server string, name string, qtype dnsmessage.Type) (dnsmessage.RCode, []skydnsAnswer) {
+	t.Helper()
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET})
+	req, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p dnsmessage.Parser
+	h, err := p.Start(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	resources, err := p.AllAnswers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answers := []skydnsAnswer{}
+	for _, r := range resources {
+		switch body := r.Body.(type) {
+		case *dnsmessage.AResource:
+			answers = append(answers, skydnsAnswer{IP: net.IP(body.A[:]).String(), TTL: r.Header.TTL})
+		case *dnsmessage.AAAAResource:
+			answers = append(answers, skydnsAnswer{IP: net.IP(body.AAAA[:]).String(), TTL: r.Header.TTL})
+		}
+	}
+
+	return h.RCode, answers
+}
+
+// Verify the harness reads the entries the way CoreDNS does
+func TestSkyDNSServer(t *testing.T) {
+
+	store := sink.NewMemoryStore(clock.NewFakeClock(time.Now()))
+
+	rs := controller.RecordSet{RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 30, OwnerID: controller.DefaultOwnerID}
+	for _, entry := range controller.BuildEntries(rs, []string{"10.0.0.1", "fd00::2", "10.0.0.1"}) {
+		store.Put(entry.Key, entry.Val)
+	}
+	store.Put("/skydns/local/external", `{"host":"10.0.9.9"}`)
+
+	server := startSkyDNSServer(t, "skydns", func(ctx context.Context, prefix string) ([]controller.Entry, error) {
+		return store.List(prefix), nil
+	})
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		qtype    dnsmessage.Type
+		rcode    dnsmessage.RCode
+		expected []skydnsAnswer
+	}{
+		{name: "kubemaster.local.", qtype: dnsmessage.TypeA, expected: []skydnsAnswer{{"10.0.0.1", 30}}},
+		{name: "KubeMaster.Local.", qtype: dnsmessage.TypeA, expected: []skydnsAnswer{{"10.0.0.1", 30}}},
+		{name: "kubemaster.local.", qtype: dnsmessage.TypeAAAA, expected: []skydnsAnswer{{"fd00::2", 30}}},
+		{name: "x2.kubemaster.local.", qtype: dnsmessage.TypeAAAA, expected: []skydnsAnswer{{"fd00::2", 30}}},
+		{name: "x2.kubemaster.local.", qtype: dnsmessage.TypeA, expected: []skydnsAnswer{}},
+		{name: "external.local.", qtype: dnsmessage.TypeA, expected: []skydnsAnswer{{"10.0.9.9", skydnsDefaultTTL}}},
+		{name: "other.local.", qtype: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError, expected: []skydnsAnswer{}},
+	}
+
+	for _, tt := range tests {
+		rcode, answers := querySkyDNS(t, server.Addr(), tt.name, tt.qtype)
+		if rcode != tt.rcode || !reflect.DeepEqual(answers, tt.expected) {
+			t.Errorf("%s %s: expected %s %v but got %s %v", tt.name, tt.qtype, tt.rcode, tt.expected, rcode, answers)
+		}
+	}
+}
+
+// Verify the node events end up in the dns answers
+func TestControllerResolvable(t *testing.T) {
+
+	store := sink.NewMemoryStore(clock.NewFakeClock(time.Now()))
+
+	server := startSkyDNSServer(t, "skydns", func(ctx context.Context, prefix string) ([]controller.Entry, error) {
+		return store.List(prefix), nil
+	})
+	defer server.Close()
+
+	node1 := testutil.NewMasterNode("node1", "10.0.0.1", "True")
+	clientset := fake.NewSimpleClientset(node1)
+
+	rs := controller.RecordSet{RootKey: "skydns", DomainName: "kubemaster.local", TTL: 30, OwnerID: controller.DefaultOwnerID}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go controller.RunController(ctx, rs, sink.NewMemoryLease(store, rs.OwnerID), source.NewInformer("node-role.kubernetes.io/master=", clientset))
+
+	resolver := newResolver(server.Addr())
+	resolves := func(expected ...string) func() bool {
+		return func() bool {
+			ips, err := resolveHostIPs(ctx, resolver, rs.DomainName)
+			return err == nil && reflect.DeepEqual(normalizeIPs(ips), expected)
+		}
+	}
+
+	testutil.WaitFor(t, "the first node", resolves("10.0.0.1"))
+
+	if _, err := clientset.CoreV1().Nodes().Create(testutil.NewMasterNode("node2", "fd00::2", "True")); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitFor(t, "the AAAA of the second node", resolves("10.0.0.1", "fd00::2"))
+
+	notReady := node1.DeepCopy()
+	notReady.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+	if _, err := clientset.CoreV1().Nodes().Update(notReady); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitFor(t, "the not ready node to go", resolves("fd00::2"))
+
+	if _, answers := querySkyDNS(t, server.Addr(), "kubemaster.local.", dnsmessage.TypeAAAA); len(answers) != 1 || answers[0].TTL != 30 {
+		t.Errorf("Expected the ttl of the record set, got %v", answers)
+	}
+
+	if err := clientset.CoreV1().Nodes().Delete("node2", nil); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitFor(t, "the name to go", func() bool {
+		rcode, _ := querySkyDNS(t, server.Addr(), "kubemaster.local.", dnsmessage.TypeA)
+		return rcode == dnsmessage.RCodeNameError
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// VerifyReport - Compare what dns answers with the host ips of the sources
+type VerifyReport struct {
+	DomainName string   `json:"domainName"`
+	Server     string   `json:"server"`
+	Expected   []string `json:"expected"`
+	Resolved   []string `json:"resolved"`
+	Missing    []string `json:"missing,omitempty"`
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+// OK - Dns answers exactly the host ips
+func (r VerifyReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Unexpected) == 0
+}
+
+// newResolver - Send every query to the given dns server instead of the system one
+func newResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// resolveHostIPs - Read the A and AAAA records of the domain, none when the name does not exist
+// or has no address, an error only when the dns server could not answer
+func resolveHostIPs(ctx context.Context, resolver *net.Resolver, domainName string) ([]string, error) {
+
+	//Rooted name so the search domains of the host are not tried
+	addrs, err := resolver.LookupIPAddr(ctx, strings.TrimSuffix(domainName, ".")+".")
+	if isNotFound(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]string, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP.String()
+	}
+
+	return ips, nil
+}
+
+// isNotFound - The dns server answered NXDOMAIN or no address at all, nothing is published under the name
+func isNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && !dnsErr.IsTimeout && !dnsErr.IsTemporary && dnsErr.Err == "no such host"
+}
+
+// compareAddresses - Find the host ips dns does not return and the answers no host ip is behind
+func compareAddresses(expected []string, resolved []string) VerifyReport {
+
+	report := VerifyReport{
+		Expected:   normalizeIPs(expected),
+		Resolved:   normalizeIPs(resolved),
+		Missing:    []string{},
+		Unexpected: []string{},
+	}
+
+	answered := make(map[string]struct{}, len(report.Resolved))
+	for _, ip := range report.Resolved {
+		answered[ip] = struct{}{}
+	}
+
+	wanted := make(map[string]struct{}, len(report.Expected))
+	for _, ip := range report.Expected {
+		wanted[ip] = struct{}{}
+		if _, ok := answered[ip]; !ok {
+			report.Missing = append(report.Missing, ip)
+		}
+	}
+
+	for _, ip := range report.Resolved {
+		if _, ok := wanted[ip]; !ok {
+			report.Unexpected = append(report.Unexpected, ip)
+		}
+	}
+
+	return report
+}
+
+// normalizeIPs - Same textual form for the same address, sorted and without duplicates
+func normalizeIPs(ips []string) []string {
+
+	seen := map[string]struct{}{}
+	out := []string{}
+
+	for _, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ip = parsed.String()
+		}
+		if _, ok := seen[ip]; ok {
+			continue
+		}
+		seen[ip] = struct{}{}
+		out = append(out, ip)
+	}
+
+	sort.Strings(out)
+	return out
+}
+
+// printVerifyReport - Readable report of the verification
+func printVerifyReport(w io.Writer, r VerifyReport) {
+
+	status := "OK"
+	if !r.OK() {
+		status = "MISMATCH"
+	}
+
+	fmt.Fprintf(w, "%s: %s via %s\n", status, r.DomainName, r.Server)
+	fmt.Fprintf(w, "  host ips:    %s\n", strings.Join(r.Expected, ", "))
+	fmt.Fprintf(w, "  dns answers: %s\n", strings.Join(r.Resolved, ", "))
+	if len(r.Missing) > 0 {
+		fmt.Fprintf(w, "  missing from dns: %s\n", strings.Join(r.Missing, ", "))
+	}
+	if len(r.Unexpected) > 0 {
+		fmt.Fprintf(w, "  not a host ip: %s\n", strings.Join(r.Unexpected, ", "))
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/sink"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Verify the dns answers are compared with the host ips
+func TestVerifyCompareAddresses(t *testing.T) {
+
+	testCases := []struct {
+		expected   []string
+		resolved   []string
+		missing    []string
+		unexpected []string
+	}{
+		{expected: []string{"10.0.0.2", "10.0.0.1"}, resolved: []string{"10.0.0.1", "10.0.0.2"}},
+		{expected: []string{"10.0.0.1", "10.0.0.2"}, resolved: []string{"10.0.0.1"}, missing: []string{"10.0.0.2"}},
+		{expected: []string{"10.0.0.1"}, resolved: []string{"10.0.0.1", "10.0.0.9"}, unexpected: []string{"10.0.0.9"}},
+		{expected: []string{"fd00::0001"}, resolved: []string{"fd00::1"}},
+	}
+
+	for i, tc := range testCases {
+		report := compareAddresses(tc.expected, tc.resolved)
+
+		if fmt.Sprint(report.Missing) != fmt.Sprint(append([]string{}, tc.missing...)) {
+			t.Errorf("test item %d expected missing %v but outcome %v", i, tc.missing, report.Missing)
+		}
+		if fmt.Sprint(report.Unexpected) != fmt.Sprint(append([]string{}, tc.unexpected...)) {
+			t.Errorf("test item %d expected unexpected %v but outcome %v", i, tc.unexpected, report.Unexpected)
+		}
+		if report.OK() != (len(tc.missing) == 0 && len(tc.unexpected) == 0) {
+			t.Errorf("test item %d unexpected outcome %t", i, report.OK())
+		}
+	}
+
+	var buf bytes.Buffer
+	report := compareAddresses([]string{"10.0.0.1"}, []string{"10.0.0.9"})
+	report.DomainName = "kubemaster.local"
+	report.Server = "127.0.0.1:8053"
+	printVerifyReport(&buf, report)
+
+	expected := `MISMATCH: kubemaster.local via 127.0.0.1:8053
+  host ips:    10.0.0.1
+  dns answers: 10.0.0.9
+  missing from dns: 10.0.0.1
+  not a host ip: 10.0.0.9
+`
+	if buf.String() != expected {
+		t.Errorf("Expected report %q but got %q", expected, buf.String())
+	}
+}
+
+// Verify a name dns does not know has every host ip missing and only a failing server is an error
+func TestVerifyNXDomain(t *testing.T) {
+
+	store := sink.NewMemoryStore(clock.NewFakeClock(time.Now()))
+	store.Put("/skydns/local/other/x1", `{"host":"10.0.0.9"}`)
+
+	server := startSkyDNSServer(t, "skydns", func(ctx context.Context, prefix string) ([]controller.Entry, error) {
+		return store.List(prefix), nil
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resolved, err := resolveHostIPs(ctx, newResolver(server.Addr()), "kubemaster.local")
+	if err != nil {
+		t.Fatalf("Expected no error on NXDOMAIN but got %s", err.Error())
+	}
+	if len(resolved) != 0 {
+		t.Errorf("Expected no answer but got %v", resolved)
+	}
+
+	report := compareAddresses([]string{"10.0.0.2", "10.0.0.1"}, resolved)
+	if report.OK() || fmt.Sprint(report.Missing) != "[10.0.0.1 10.0.0.2]" {
+		t.Errorf("Expected every host ip missing but got %+v", report)
+	}
+
+	failing := startSkyDNSServer(t, "skydns", func(ctx context.Context, prefix string) ([]controller.Entry, error) {
+		return nil, errors.New("etcd is gone")
+	})
+	defer failing.Close()
+
+	if _, err := resolveHostIPs(ctx, newResolver(failing.Addr()), "kubemaster.local"); err == nil {
+		t.Error("Expected an error when the dns server fails")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tweakmy/fotofona/registry"
+)
+
+var (
+	// flagDNSServer - Dns server to query, e.g. the CoreDNS reading the etcd
+	flagDNSServer *string
+
+	// flagVerifyTimeout - Give up on the whole verification after this long
+	flagVerifyTimeout *time.Duration
+)
+
+func init() {
+	flagDNSServer = verifyCmd.Flags().StringP("dns-server", "", "127.0.0.1:53", "dns server host:port to query")
+	flagVerifyTimeout = verifyCmd.Flags().DurationP("timeout", "", 30*time.Second, "give up on the verification after this long")
+	registry.AddSourceFlags(verifyCmd.Flags(), &opts)
+
+	RootCmd.AddCommand(verifyCmd)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Resolve --domainname and compare the answers with the host ips of --source",
+	Long: `Query --dns-server for the A and AAAA records of --domainname and compare them
+with the host ips the controller would publish for --source. Exit non-zero on any mismatch,
+a name --dns-server does not know has every host ip missing.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		ctx, cancel := context.WithTimeout(context.Background(), *flagVerifyTimeout)
+		defer cancel()
+
+		rs, err := opts.RecordSet()
+		if err != nil {
+			return err
+		}
+
+		clientset, err := opts.KubeClient()
+		if err != nil {
+			return err
+		}
+
+		expected, _, err := readDesired(ctx, rs, clientset)
+		if err != nil {
+			return err
+		}
+
+		resolved, err := resolveHostIPs(ctx, newResolver(*flagDNSServer), opts.DomainName)
+		if err != nil {
+			return fmt.Errorf("Could not resolve %s via %s: %s", opts.DomainName, *flagDNSServer, err.Error())
+		}
+
+		report := compareAddresses(expected, resolved)
+		report.DomainName = opts.DomainName
+		report.Server = *flagDNSServer
+
+		printVerifyReport(cmd.OutOrStdout(), report)
+
+		if !report.OK() {
+			return fmt.Errorf("%s does not resolve to the host ips of --source", opts.DomainName)
+		}
+
+		return nil
+	},
+}
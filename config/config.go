@@ -0,0 +1,273 @@
+// Package config - Settings of fotofona bound to the command line flags, and the clients built out of them
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/spf13/pflag"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"github.com/tweakmy/fotofona/notify"
+	"github.com/tweakmy/fotofona/source"
+)
+
+// Where the entries are written, see the deprecated --backend
+const (
+	BackendEtcd   = "etcd"
+	BackendMemory = "memory"
+)
+
+// Selected unless --source or --sink say otherwise
+const (
+	DefaultSource = "nodes"
+	DefaultSink   = "etcd"
+)
+
+// Options - Everything the flags configure, the zero value is not usable until the flags are added and parsed
+type Options struct {
+	//RootPath - Etcd root path where coreDNS look for the domain
+	RootPath string
+
+	//DomainName - Domain name of the kubernetes master
+	DomainName string
+
+	//KubeConfig - Path to the kubeconfig, only read with UseKubeConfig
+	KubeConfig string
+
+	//UseKubeConfig - Use the kubeconfig instead of the service account
+	UseKubeConfig bool
+
+	//WatchLabels - Node labels to be watched from k8s api server
+	WatchLabels string
+
+	//ZoneLabel - Node label grouping the host ips into per zone names, empty disables them
+	ZoneLabel string
+
+	//WeightAnnotation - Node annotation holding the SkyDNS weight of its host ip, empty disables it
+	WeightAnnotation string
+
+	//DefaultWeight - SkyDNS weight of the host ips without a weight annotation, 0 leaves the field out
+	DefaultWeight int
+
+	//EtcdEndpoints - Etcd servers coreDNS read the domain from, set by the flags of the etcd sink
+	EtcdEndpoints []string
+
+	//InsecureSkipTLSVerify, CACert, Cert and Key - TLS settings of the etcd client, set by the flags of the etcd sink
+	InsecureSkipTLSVerify bool
+	CACert                string
+	Cert                  string
+	Key                   string
+
+	//OwnerID - Owner marker written into every entry, keys of other owners are left alone
+	OwnerID string
+
+	//TTL - Dns TTL in seconds written into every entry
+	TTL int
+
+	//LeaseTTL - Lease in seconds holding the entries, 0 derive it from the TTL
+	LeaseTTL int
+
+	//DryRun - Log what would be changed in etcd without writing anything
+	DryRun bool
+
+	//Backend - etcd, or memory to publish nowhere but the log, replaced by Sinks
+	Backend string
+
+	//Sources - Names of the registered sources the host ips come from
+	Sources []string
+
+	//SourceMerge - union or fallback, how the host ips of several sources are combined
+	SourceMerge string
+
+	//ProbePort - Only publish the host ips accepting a tcp connection on it, 0 disables the probe
+	ProbePort int
+
+	//ProbeTimeout and ProbeInterval - Bound of every probe and how often the host ips are probed again
+	ProbeTimeout  time.Duration
+	ProbeInterval time.Duration
+
+	//Sinks - Names of the registered sinks the entries are written to
+	Sinks []string
+
+	//SinkFailurePolicy - isolate or block, whether a failing sink holds back the others
+	SinkFailurePolicy string
+
+	//SinkRetries - Retries of a failing sink before the publication is given up on it
+	SinkRetries int
+
+	//EventObject - Object receiving the failure events, kind/namespace/name
+	EventObject string
+
+	//LogFormat - json or text, verbosity still follows -v
+	LogFormat string
+
+	//HistoryPrefix - Etcd prefix holding the history of the published host ips
+	HistoryPrefix string
+
+	//HistoryLimit - Publications kept in the history of each domain, 0 disables it
+	HistoryLimit int
+
+	//HTTPAddr - Address serving the history and the metrics, empty disables it
+	HTTPAddr string
+
+	//WebhookURLs - Endpoints receiving a POST whenever the published host ips change
+	WebhookURLs []string
+
+	//WebhookSecretFile - File holding the shared secret signing the webhook payload
+	WebhookSecretFile string
+
+	//WebhookTimeout - Bound of every webhook attempt
+	WebhookTimeout time.Duration
+
+	//WebhookRetries - Attempts after the first one when the webhook is unavailable
+	WebhookRetries int
+
+	//CRD - Publish the MasterDNSRecord objects instead of the domain name
+	CRD bool
+}
+
+// AddPersistentFlags - Settings shared by the controller and every subcommand
+func (o *Options) AddPersistentFlags(fs *pflag.FlagSet) {
+
+	// kubeconfig - default kubeconfig
+	var kubeconfig = filepath.Join(
+		os.Getenv("HOME"), ".kube", "config",
+	)
+
+	fs.StringVarP(&o.RootPath, "rootpath", "", "/skydns", "Etcd root path to store the domain")
+	fs.StringVarP(&o.DomainName, "domainname", "", "kubemaster.local", "Domain name of the kubernetes master")
+	fs.StringVarP(&o.KubeConfig, "kubeconfigpath", "", kubeconfig, "enter a kubeconfig path")
+	fs.BoolVarP(&o.UseKubeConfig, "usekubeconfig", "u", false, "default to use service account; if set: use kubeconfig path ")
+	fs.StringVarP(&o.WatchLabels, "watchlabels", "l", "node-role.kubernetes.io/master=", "watch labels for nodes to be DNS")
+	fs.StringVarP(&o.ZoneLabel, "zone-label", "", source.DefaultZoneLabel, "node label publishing the host ips of each zone as <zone>.<domainname> too; empty: no zone names")
+	fs.StringVarP(&o.WeightAnnotation, "weight-annotation", "", source.DefaultWeightAnnotation, "node annotation holding the SkyDNS weight of its host ip, 1 to 65535; empty: weights are not read")
+	fs.IntVarP(&o.DefaultWeight, "default-weight", "", 100, "SkyDNS weight of the host ips without a weight annotation; 0: no weight field")
+	fs.IntVarP(&o.TTL, "ttl", "", 60, "dns TTL in seconds written into every entry")
+	fs.IntVarP(&o.LeaseTTL, "lease-ttl", "", 0, "etcd lease in seconds holding the entries, must not exceed --ttl; 0: half of --ttl")
+	fs.StringVarP(&o.OwnerID, "owner-id", "", controller.DefaultOwnerID, "owner marker written into every entry; keys of other owners and without any owner are never overwritten or removed, see --adopt-legacy-keys")
+	fs.StringVarP(&o.LogFormat, "log-format", "", logging.FormatJSON, "log line format: json or text; -v still sets the verbosity")
+	fs.StringVarP(&o.HistoryPrefix, "history-prefix", "", "/fotofona-history", "etcd prefix holding the history of the published host ips, must not overlap with --rootpath")
+}
+
+// AddFlags - Settings of the controller only
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVarP(&o.DryRun, "dry-run", "", false, "log what would be changed in etcd without writing anything")
+	fs.StringVarP(&o.Backend, "backend", "", BackendEtcd, "etcd, or memory: keep the entries in memory and only log them, no etcd needed")
+	fs.MarkDeprecated("backend", "use --sink instead")
+	fs.IntVarP(&o.HistoryLimit, "history-limit", "", 100, "publications kept in the history of the domain; 0: no history")
+	fs.StringVarP(&o.HTTPAddr, "http-addr", "", "", "address serving /history and /debug/vars, e.g. :8080; empty: disabled")
+	fs.StringSliceVarP(&o.WebhookURLs, "webhook-url", "", []string{}, "comma separated urls receiving a json POST whenever the published host ips change")
+	fs.StringVarP(&o.WebhookSecretFile, "webhook-secret-file", "", "", "file holding the secret signing the webhook body with HMAC-SHA256 in the X-Fotofona-Signature header")
+	fs.DurationVarP(&o.WebhookTimeout, "webhook-timeout", "", 5*time.Second, "timeout of every webhook attempt")
+	fs.IntVarP(&o.WebhookRetries, "webhook-retries", "", 3, "retries when the webhook is unreachable or answers 5xx or 429")
+	fs.BoolVarP(&o.CRD, "crd", "", false, "publish every MasterDNSRecord object instead of --domainname and --watchlabels; --ttl and --lease-ttl are the defaults")
+	fs.StringVarP(&o.EventObject, "event-object", "", DefaultEventObject(), "kind/namespace/name receiving the lease, etcd and informer failure events; defaults to the pod from POD_NAMESPACE and POD_NAME")
+}
+
+// RecordSet - Validate the user input and describe the record set to be published
+func (o *Options) RecordSet() (controller.RecordSet, error) {
+
+	if o.RootPath == "" {
+		return controller.RecordSet{}, errors.New("--rootpath: must not be empty")
+	}
+
+	if !govalidator.IsDNSName(o.DomainName) {
+		return controller.RecordSet{}, errors.New("--domainname: should use qualified domain name")
+	}
+
+	if o.OwnerID == "" {
+		return controller.RecordSet{}, errors.New("--owner-id: must not be empty")
+	}
+
+	rs := controller.RecordSet{
+		RootKey:    o.RootPath,
+		DomainName: o.DomainName,
+		TTL:        o.TTL,
+		LeaseTTL:   o.LeaseTTL,
+		OwnerID:    o.OwnerID,
+		Weight:     o.DefaultWeight,
+	}
+
+	return rs, rs.Validate()
+}
+
+// ValidateBackend - Where the entries are written
+func ValidateBackend(backend string) error {
+	if backend != BackendEtcd && backend != BackendMemory {
+		return fmt.Errorf("--backend: %q must be %s or %s", backend, BackendEtcd, BackendMemory)
+	}
+	return nil
+}
+
+// SinkNames - Sinks selected with --sink, --backend memory still selects the memory sink alone
+func (o *Options) SinkNames() ([]string, error) {
+
+	if err := ValidateBackend(o.Backend); err != nil {
+		return nil, err
+	}
+
+	if o.Backend == BackendMemory {
+		return []string{BackendMemory}, nil
+	}
+
+	return o.Sinks, nil
+}
+
+// ValidateHistoryPrefix - CoreDNS serves everything under --rootpath, the history has to live elsewhere
+func ValidateHistoryPrefix(historyPrefix string, rootPath string) error {
+
+	history := "/" + strings.Trim(historyPrefix, "/")
+	root := "/" + strings.Trim(rootPath, "/")
+
+	if history == "/" {
+		return errors.New("--history-prefix: must not be empty")
+	}
+
+	if history == root || strings.HasPrefix(history, root+"/") || strings.HasPrefix(root, history+"/") {
+		return errors.New("--history-prefix: must not overlap with --rootpath")
+	}
+
+	return nil
+}
+
+// Webhook - Validate the webhook settings, nil when there is no url to notify
+func (o *Options) Webhook() (*notify.WebhookNotifier, error) {
+
+	if len(o.WebhookURLs) == 0 {
+		return nil, nil
+	}
+
+	for _, u := range o.WebhookURLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("--webhook-url: %q must be an http or https url", u)
+		}
+	}
+
+	if o.WebhookTimeout <= 0 {
+		return nil, errors.New("--webhook-timeout: must be positive")
+	}
+
+	if o.WebhookRetries < 0 {
+		return nil, errors.New("--webhook-retries: must not be negative")
+	}
+
+	var secret []byte
+	if o.WebhookSecretFile != "" {
+		b, err := ioutil.ReadFile(o.WebhookSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("--webhook-secret-file: %s", err.Error())
+		}
+		secret = []byte(strings.TrimSpace(string(b)))
+	}
+
+	return notify.NewWebhookNotifier(o.WebhookURLs, secret, o.WebhookTimeout, o.WebhookRetries), nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestValidateHistoryPrefix(t *testing.T) {
+
+	tests := []struct {
+		history string
+		root    string
+		ok      bool
+	}{
+		{history: "/fotofona-history", root: "/skydns", ok: true},
+		{history: "/skydns-history", root: "/skydns/", ok: true},
+		{history: "/skydns/history", root: "/skydns", ok: false},
+		{history: "skydns", root: "/skydns", ok: false},
+		{history: "/", root: "/skydns/kube", ok: false},
+		{history: "/skydns", root: "/skydns/kube", ok: false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateHistoryPrefix(tt.history, tt.root)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s under %s: expected ok %t but got %v", tt.history, tt.root, tt.ok, err)
+		}
+	}
+}
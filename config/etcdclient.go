@@ -0,0 +1,65 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// EtcdClient - Connect to etcd with the endpoints and TLS settings from the flags
+func (o *Options) EtcdClient() (*clientv3.Client, error) {
+
+	cfg := clientv3.Config{
+		Endpoints:   o.EtcdEndpoints,
+		DialTimeout: 2 * time.Second,
+	}
+
+	tlsConfig, err := etcdTLSConfig(o.CACert, o.Cert, o.Key, o.InsecureSkipTLSVerify)
+	if err != nil {
+		return nil, err
+	}
+	cfg.TLS = tlsConfig
+
+	return clientv3.New(cfg)
+}
+
+// etcdTLSConfig - Build the TLS settings, nil when none of the TLS flags is set
+func etcdTLSConfig(cacert, cert, key string, insecureSkipVerify bool) (*tls.Config, error) {
+
+	if cacert == "" && cert == "" && key == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, fmt.Errorf("--cert and --key: must be set together")
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("--cert and --key: %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	if cacert != "" {
+		pem, err := ioutil.ReadFile(cacert)
+		if err != nil {
+			return nil, fmt.Errorf("--cacerts: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("--cacerts: no certificate found in %s", cacert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+
+	v1Api "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventComponent - Source of every event emitted by fotofona
+const eventComponent = "fotofona"
+
+// NewEventRecorder - Recorder sending the events to the kubernetes api server, stop ends the sending
+func NewEventRecorder(clientset kubernetes.Interface) (recorder record.EventRecorder, stop func()) {
+
+	broadcaster := record.NewBroadcaster()
+	logWatcher := broadcaster.StartLogging(logging.Logger(logging.ComponentEvents).Sugar().Infof)
+	sinkWatcher := broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+
+	stop = func() {
+		logWatcher.Stop()
+		sinkWatcher.Stop()
+	}
+
+	return broadcaster.NewRecorder(scheme.Scheme, v1Api.EventSource{Component: eventComponent}), stop
+}
+
+// DefaultEventObject - Our own pod when the downward api exposes POD_NAME and POD_NAMESPACE
+func DefaultEventObject() string {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf("Pod/%s/%s", os.Getenv("POD_NAMESPACE"), name)
+}
+
+// ParseEventObject - Read kind/namespace/name or kind/name for cluster scoped objects
+func ParseEventObject(spec string) (*v1Api.ObjectReference, error) {
+
+	parts := strings.Split(spec, "/")
+	ref := &v1Api.ObjectReference{Kind: parts[0], APIVersion: "v1"}
+
+	switch len(parts) {
+	case 2:
+		ref.Name = parts[1]
+	case 3:
+		ref.Namespace = parts[1]
+		ref.Name = parts[2]
+		if ref.Namespace == "" {
+			ref.Namespace = metaV1.NamespaceDefault
+		}
+	}
+
+	if ref.Kind == "" || ref.Name == "" || len(parts) > 3 {
+		return nil, fmt.Errorf("--event-object: %q must be kind/namespace/name or kind/name", spec)
+	}
+
+	return ref, nil
+}
+
+// ResolveEventObject - kubectl describe only shows the events carrying the uid of the object
+func ResolveEventObject(clientset kubernetes.Interface, ref *v1Api.ObjectReference) *v1Api.ObjectReference {
+
+	var uid = ref.UID
+
+	switch ref.Kind {
+	case "Pod":
+		pod, err := clientset.CoreV1().Pods(ref.Namespace).Get(ref.Name, metaV1.GetOptions{})
+		if err != nil {
+			logging.Logger(logging.ComponentEvents).Warn("Could not look up the event object",
+				zap.String("namespace", ref.Namespace), zap.String("name", ref.Name), zap.Error(err))
+			return ref
+		}
+		uid = pod.UID
+	case "Node":
+		node, err := clientset.CoreV1().Nodes().Get(ref.Name, metaV1.GetOptions{})
+		if err != nil {
+			logging.Logger(logging.ComponentEvents).Warn("Could not look up the event object", zap.String("name", ref.Name), zap.Error(err))
+			return ref
+		}
+		uid = node.UID
+	}
+
+	resolved := *ref
+	resolved.UID = uid
+	return &resolved
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseEventObject(t *testing.T) {
+
+	tests := []struct {
+		spec     string
+		expected v1.ObjectReference
+		wantErr  bool
+	}{
+		{spec: "Pod/kube-system/fotofona-0", expected: v1.ObjectReference{Kind: "Pod", Namespace: "kube-system", Name: "fotofona-0", APIVersion: "v1"}},
+		{spec: "Pod//fotofona-0", expected: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "fotofona-0", APIVersion: "v1"}},
+		{spec: "Node/master-1", expected: v1.ObjectReference{Kind: "Node", Name: "master-1", APIVersion: "v1"}},
+		{spec: "fotofona-0", wantErr: true},
+		{spec: "Pod/", wantErr: true},
+		{spec: "/kube-system/fotofona-0", wantErr: true},
+		{spec: "Pod/a/b/c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		ref, err := ParseEventObject(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error but got %+v", tt.spec, ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tt.spec, err.Error())
+			continue
+		}
+		if *ref != tt.expected {
+			t.Errorf("%s: expected %+v but got %+v", tt.spec, tt.expected, *ref)
+		}
+	}
+}
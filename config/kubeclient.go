@@ -0,0 +1,52 @@
+package config
+
+import (
+	"errors"
+	"os"
+
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// RESTConfig - Use the service account unless --usekubeconfig is set
+func (o *Options) RESTConfig() (*rest.Config, error) {
+
+	kubeconfig := ""
+	if o.UseKubeConfig {
+		if _, err := os.Stat(o.KubeConfig); os.IsNotExist(err) {
+			return nil, errors.New("--kubeconfigpath: kubeconfig path must exist")
+		}
+		kubeconfig = o.KubeConfig
+		logging.Logger(logging.ComponentCmd).Info("Using kubeconfig", zap.String("kubeconfig", kubeconfig))
+	} else {
+		logging.Logger(logging.ComponentCmd).Info("Using service account")
+	}
+
+	return clientcmd.BuildConfigFromFlags("", kubeconfig)
+}
+
+// KubeClient - Connect to the kubernetes api server
+func (o *Options) KubeClient() (kubernetes.Interface, error) {
+
+	config, err := o.RESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+// DynamicClient - Reach the custom resources of the kubernetes api server
+func (o *Options) DynamicClient() (dynamic.Interface, error) {
+
+	config, err := o.RESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(config)
+}
@@ -0,0 +1,338 @@
+// Package controller - Keep the host ips of a source published through a sink, one record set at a time
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+
+	v1Api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+)
+
+// RetryBackoff - Wait before the first retry of a failed publication, doubled on every following one
+const RetryBackoff = time.Second
+
+// Reasons of the Warning events emitted on the event object
+const (
+	ReasonLeaseFailed    = "LeaseFailed"
+	ReasonWriteFailed    = "EtcdWriteFailed"
+	ReasonInformerClosed = "InformerClosed"
+)
+
+// WriteError - The lease is fine but the entry could not be written
+type WriteError struct {
+	Key string
+	Err error
+}
+
+func (w *WriteError) Error() string {
+	return fmt.Sprintf("could not write %s: %s", w.Key, w.Err.Error())
+}
+
+// Controller - Keep the host ips of the informer published through the lease
+type Controller struct {
+	RecordSet RecordSet
+	Lease     LeaseInf
+	Informer  InformerInf
+
+	//Recorder - Optional, report the failures as Warning events on EventObject
+	Recorder    record.EventRecorder
+	EventObject *v1Api.ObjectReference
+
+	//Observers - Told about every set of host ips written for the record set
+	Observers []Observer
+
+	//Clock - Optional, times the publications and the retries, the real clock when nil
+	Clock clock.Clock
+}
+
+// What made the controller publish the host ips again
+const (
+	TriggerStartup   = "startup"
+	TriggerInformer  = "informer"
+	TriggerLeaseLost = "lease-lost"
+	TriggerDrift     = "drift"
+)
+
+// RunController - Run the loop to periodically write the loop
+func RunController(ctx context.Context, rs RecordSet, lease LeaseInf, inf InformerInf) {
+	c := &Controller{RecordSet: rs, Lease: lease, Informer: inf}
+	c.Run(ctx)
+}
+
+// Run - Publish the host ips until the context is done or the informer gives up
+func (c *Controller) Run(ctx context.Context) {
+
+	rs, lease, inf := c.RecordSet, c.Lease, c.Informer
+	clk := clockutil.OrDefault(c.Clock)
+	log := logging.Logger(logging.ComponentController).With(zap.String("domain", rs.DomainName))
+
+	//Whatever the lease still does in the background stops with the controller
+	if cl, ok := lease.(ClosingLeaseInf); ok {
+		defer cl.Close()
+	}
+
+	retryCount := 0
+
+	//What was published last and why we are publishing again
+	var published []string
+	trigger := TriggerStartup
+
+	//Dns name remain constant over long period of time
+	prefix := rs.Prefix()
+
+	go inf.Start(ctx)
+
+loop:
+	for {
+
+		var errLease error
+
+		log.Info("Controller started")
+
+		hostips, entries, err := DesiredEntries(ctx, rs, inf)
+		if err != nil {
+			log.Error("Could not read the host ips", zap.Error(err))
+			retryCount++
+			goto retry
+		}
+
+		log.Info("Publishing the host ips", zap.Strings("ips", hostips))
+
+		//Initally connect to etcd server and get the interupt channel
+		errLease = lease.InitLease(ctx, entries, rs.LeaseTime())
+
+		if errLease == nil {
+			retryCount = 0
+
+			//Whatever we owned previously but no longer desired has to go
+			if err := lease.RemoveStale(ctx, prefix, entries); err != nil {
+				log.Error("Could not remove the stale keys", zap.String("prefix", prefix), zap.Error(err))
+				c.warn(ctx, ReasonWriteFailed, "Could not remove the stale keys of %s: %s", rs.DomainName, err.Error())
+			}
+
+			c.notify(ctx, Publication{
+				Time:    clk.Now().UTC(),
+				Domain:  rs.DomainName,
+				Trigger: trigger,
+				Old:     published,
+				New:     hostips,
+			})
+			published = hostips
+
+			//Come back here as soon as someone touches what we published
+			if err := lease.WatchDrift(ctx, prefix, entries); err != nil {
+				log.Error("Could not watch the published keys", zap.String("prefix", prefix), zap.Error(err))
+			}
+
+			select {
+			case <-lease.GetRenewalInteruptChan():
+				log.Info("Controller detected an interuption on the renewal")
+				//The lease is lost, the next write grants a new one
+				c.warn(ctx, ReasonLeaseFailed, "Lease holding %s was lost, granting a new one", rs.DomainName)
+				trigger = TriggerLeaseLost
+
+			case <-lease.GetDriftChan():
+				log.Info("Controller detected a drift on the published keys")
+				driftCorrections.Add(1)
+				trigger = TriggerDrift
+
+			case <-inf.GetInformerInterupt():
+				log.Info("Controller detected an informer change")
+				//The same lease is kept, the next write attach the new entries and remove the stale ones
+				trigger = TriggerInformer
+			case <-inf.GetInformerErrorClose():
+				log.Info("Closing informer due to error")
+				c.warn(ctx, ReasonInformerClosed, "Node informer shut down after repeated errors, %s is no longer updated", rs.DomainName)
+				break loop
+			case <-ctx.Done(): //Parent ask to quit
+				log.Info("Cancelling controller work")
+				break loop
+
+			}
+		} else {
+			log.Error("Could not publish the entries", zap.Int("retry", retryCount+1), zap.Error(errLease))
+			if _, ok := errLease.(*WriteError); ok {
+				c.warn(ctx, ReasonWriteFailed, "Could not publish %s: %s", rs.DomainName, errLease.Error())
+			} else {
+				c.warn(ctx, ReasonLeaseFailed, "Could not publish %s: %s", rs.DomainName, errLease.Error())
+			}
+			retryCount++
+		}
+	retry:
+
+		if retryCount == 3 {
+			break loop
+		}
+
+		//Give etcd and the api server some room before trying again
+		if retryCount > 0 {
+			select {
+			case <-clk.After(RetryBackoff << uint(retryCount-1)):
+			case <-ctx.Done():
+				break loop
+			}
+		}
+	}
+
+}
+
+// DesiredEntries - Read the host ips of the informer and build the entries published for them,
+// the global set and the one of every zone; diff and the controller publish the same way through it
+func DesiredEntries(ctx context.Context, rs RecordSet, inf InformerInf) ([]string, []Entry, error) {
+
+	hostips, err := inf.GetHostIPs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostips = rs.FilterIPs(hostips)
+	weights := hostWeights(ctx, rs, inf)
+	entries := BuildWeightedEntries(rs, hostips, weights)
+
+	//The zone names live below the domain, the global set stays as it is
+	if zi, ok := inf.(ZoneInformerInf); ok {
+		zones, err := zi.GetHostZones(ctx)
+		if err != nil {
+			logging.Logger(logging.ComponentController).Error("Could not read the zones of the host ips", zap.String("domain", rs.DomainName), zap.Error(err))
+		} else {
+			entries = append(entries, BuildZoneEntries(rs, hostips, zones, weights)...)
+		}
+	}
+
+	return hostips, entries, nil
+}
+
+// hostWeights - Weight of the host ips when the informer tells them, nil otherwise
+func hostWeights(ctx context.Context, rs RecordSet, inf InformerInf) map[string]int {
+
+	wi, ok := inf.(WeightInformerInf)
+	if !ok {
+		return nil
+	}
+
+	weights, err := wi.GetHostWeights(ctx)
+	if err != nil {
+		logging.Logger(logging.ComponentController).Error("Could not read the weights of the host ips", zap.String("domain", rs.DomainName), zap.Error(err))
+		return nil
+	}
+	return weights
+}
+
+// notify - Tell the observers about the host ips just published
+func (c *Controller) notify(ctx context.Context, p Publication) {
+	for _, o := range c.Observers {
+		o.Published(ctx, p)
+	}
+}
+
+// warn - Tell the failure observers and emit a Warning event on the event object when there is one
+func (c *Controller) warn(ctx context.Context, reason string, messageFmt string, args ...interface{}) {
+
+	for _, o := range c.Observers {
+		if fo, ok := o.(FailureObserver); ok {
+			fo.Failed(ctx, reason, fmt.Sprintf(messageFmt, args...))
+		}
+	}
+
+	if c.Recorder == nil || c.EventObject == nil {
+		return
+	}
+	c.Recorder.Eventf(c.EventObject, v1Api.EventTypeWarning, reason, messageFmt, args...)
+}
+
+// DomainPrefix - Etcd directory holding the entries of the dns name, ending with a slash
+func DomainPrefix(rootKey string, dnsname string) string {
+	dnsArry := reverseArray(strings.Split(dnsname, "."))
+	return fmt.Sprintf("/%s/%s/", strings.Trim(rootKey, "/"), strings.Join(dnsArry, "/"))
+}
+
+// KeyToDomain - Reverse the etcd key back into the dns name, the opposite of DomainPrefix
+func KeyToDomain(rootKey string, key string) string {
+
+	root := "/" + strings.Trim(rootKey, "/") + "/"
+	labels := strings.Split(strings.Trim(strings.TrimPrefix(key, root), "/"), "/")
+
+	return strings.Join(reverseArray(labels), ".")
+}
+
+func reverseArray(a []string) []string {
+	for i := len(a)/2 - 1; i >= 0; i-- {
+		opp := len(a) - 1 - i
+		a[i], a[opp] = a[opp], a[i]
+	}
+
+	return a
+}
+
+// calcLeaseTime - It is not practical to used the same LeaseTime as DNS TTL Time
+func calcLeaseTime(dnsTTLTime int) int {
+
+	if dnsTTLTime <= 3 {
+		return 1
+	}
+
+	return dnsTTLTime / 2
+
+}
+
+// LeaseInf - Enable the controller to start leasing and wait for the signal to change flow
+// InitLease is called on every reconcile and is expected to reuse the lease while it is alive
+type LeaseInf interface {
+	InitLease(ctx context.Context, entries []Entry, leaseTime int) error
+	RemoveStale(ctx context.Context, prefix string, entries []Entry) error
+	WatchDrift(ctx context.Context, prefix string, entries []Entry) error
+	GetDriftChan() (driftDetected chan struct{})
+	GetRenewalInteruptChan() (renewalInterupted chan struct{})
+	RevokeLease(ctx context.Context) error
+}
+
+// Publication - A set of host ips written for the record set and the one it replaced
+type Publication struct {
+	Time    time.Time `json:"time"`
+	Domain  string    `json:"domain"`
+	Trigger string    `json:"trigger"`
+	Old     []string  `json:"old"`
+	New     []string  `json:"new"`
+}
+
+// Observer - Get told whenever the controller published the host ips, must not block for long
+type Observer interface {
+	Published(ctx context.Context, p Publication)
+}
+
+// FailureObserver - Optionally implemented by the observers to get told what went wrong
+type FailureObserver interface {
+	Failed(ctx context.Context, reason string, message string)
+}
+
+// ClosingLeaseInf - Optional, a lease doing more than holding the entries, closed once the controller stopped
+// The entries are left to expire, only RevokeLease removes them right away
+type ClosingLeaseInf interface {
+	Close()
+}
+
+// InformerInf - Enable the controller to determine what unique key/value to be writen to the Lease
+type InformerInf interface {
+	Start(ctx context.Context)
+	GetHostIPs(ctx context.Context) (hostip []string, err error)
+	GetInformerInterupt() (informerInterupted chan struct{})
+	GetInformerErrorClose() (errClose chan struct{})
+}
+
+// WeightInformerInf - Optional, an informer telling the SkyDNS weight of some host ips
+type WeightInformerInf interface {
+	GetHostWeights(ctx context.Context) (weights map[string]int, err error)
+}
+
+// ZoneInformerInf - Optional, an informer telling the zone of the host ips has them published per zone as well
+type ZoneInformerInf interface {
+	GetHostZones(ctx context.Context) (zones map[string]string, err error)
+}
@@ -0,0 +1,512 @@
+package controller
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testCondCtrl struct {
+	rootKey  string
+	DNSname  string
+	DNSTTL   int
+	informer *infTest
+	leaser   *leaseTest
+}
+
+func (tc testCondCtrl) recordSet() RecordSet {
+	return RecordSet{
+		RootKey:    tc.rootKey,
+		DomainName: tc.DNSname,
+		TTL:        tc.DNSTTL,
+		OwnerID:    DefaultOwnerID,
+	}
+}
+
+func runControllerFunc(tc testCondCtrl) context.CancelFunc {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go RunController(ctx, tc.recordSet(), tc.leaser, tc.informer)
+
+	return cancel
+}
+
+// Verify the Entries are correctly converted and the Leaser will get the correct value
+func TestControllerVerifyEntriesOk(t *testing.T) {
+
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tc := testCondCtrl{
+		rootKey: "rootkey",
+		DNSname: "kubemaster.local",
+		DNSTTL:  60,
+		informer: &infTest{
+			fakehostip: []string{"1.1.1.1"}, //Assumed there is only 1 Node ip available
+			fakeChan:   make(chan struct{}),
+			getDNSTestFunc: func() bool {
+				return true //Defaults to return ok everytime
+			},
+		},
+		leaser: &leaseTest{
+			fakeChan: make(chan struct{}),
+			startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+				expectedKey := "/rootkey/local/kubemaster/x1"
+				expectedVal := `{"host":"1.1.1.1","ttl":60,"owner":"fotofona","recordset":"kubemaster.local"}`
+
+				if entries[0].Key != expectedKey || entries[0].Val != expectedVal {
+					t.Errorf("Expected key: %s and value %s but go key %s and value %s",
+						expectedKey, expectedVal, entries[0].Key, entries[0].Val)
+				}
+
+				if leaseTimeInSec != 30 {
+					t.Errorf("Expected lease time expected %d vs outcome %d", 30, leaseTimeInSec)
+				}
+
+				cancel() //Stop further processing the controller
+				return true
+
+			},
+			leaseRevokeRunFunc: func() bool {
+				return true //Defaults to return ok everytime
+			},
+		},
+	}
+
+	go RunController(ctx, tc.recordSet(), tc.leaser, tc.informer)
+
+	expectDone(ctx, t, "It should write the entries")
+	cancel()
+}
+
+// Verify that if lease is stopped, it will read the informer ip address again
+func TestControllerLeaseStopOK(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	//Verify the translated key is correct
+	tc := testCondCtrl{
+		rootKey: "rootkey",
+		DNSname: "kubemaster.local",
+		DNSTTL:  10,
+		informer: &infTest{
+			fakehostip: []string{"2.2.1.11"},
+			fakeChan:   make(chan struct{}),
+			getDNSTestFunc: func() bool {
+				return true
+			},
+		},
+		leaser: &leaseTest{
+			fakeChan: make(chan struct{}),
+			startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+				expectedKey := "/rootkey/local/kubemaster/x1"
+				expectedVal := `{"host":"2.2.1.11","ttl":10,"owner":"fotofona","recordset":"kubemaster.local"}`
+
+				if entries[0].Key != expectedKey || entries[0].Val != expectedVal {
+					t.Errorf("Expected key: %s and value %s but go key %s and value %s",
+						expectedKey, expectedVal, entries[0].Key, entries[0].Val)
+				}
+
+				return true
+
+			},
+			leaseRevokeRunFunc: func() bool {
+				return true //Defaults to return ok everytime
+			},
+		},
+	}
+
+	//If the func runs a second time, it should then check the verify gate
+	tc.informer.getDNSTestFunc = func() bool {
+
+		if tc.informer.readCount > 1 {
+			cancel()
+		}
+		return true
+	}
+
+	go RunController(ctx, tc.recordSet(), tc.leaser, tc.informer)
+
+	sendSignal(t, tc.leaser.fakeChan)
+
+	expectDone(ctx, t, "It is not reading the hostsips")
+	cancel()
+}
+
+// Verify informer has changed, it will write the entries again without revoking the lease
+func TestControllerinformerChangeOk(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	//Verify the translated key is correct
+	tc := testCondCtrl{
+		rootKey: "rootkey",
+		DNSname: "kubemaster.local",
+		DNSTTL:  10,
+		informer: &infTest{
+			fakehostip: []string{"2.2.1.11"},
+			fakeChan:   make(chan struct{}),
+			getDNSTestFunc: func() bool {
+				return true
+			},
+		},
+		leaser: &leaseTest{
+			fakeChan: make(chan struct{}),
+			startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+				expectedKey := "/rootkey/local/kubemaster/x1"
+				expectedVal := `{"host":"2.2.1.11","ttl":10,"owner":"fotofona","recordset":"kubemaster.local"}`
+
+				if entries[0].Key != expectedKey || entries[0].Val != expectedVal {
+					t.Errorf("Expected key: %s and value %s but go key %s and value %s",
+						expectedKey, expectedVal, entries[0].Key, entries[0].Val)
+				}
+
+				return true
+
+			},
+			leaseRevokeRunFunc: func() bool {
+				return true //Defaults to return ok everytime
+			},
+		},
+	}
+
+	//The lease is kept, the entries are written again on the same lease
+	initCount := 0
+	tc.leaser.startLeaseFunc = func(entries []Entry, leaseTimeInSec int) bool {
+
+		initCount++
+		if initCount > 1 {
+			cancel()
+		}
+
+		return true
+	}
+
+	tc.leaser.leaseRevokeRunFunc = func() bool {
+		t.Error("It should not revoke the lease on an informer change")
+		return true
+	}
+
+	go RunController(ctx, tc.recordSet(), tc.leaser, tc.informer)
+
+	sendSignal(t, tc.informer.fakeChan)
+
+	expectDone(ctx, t, "It should write the entries again")
+	cancel()
+}
+
+// Verify the stale keys are cleaned up under the domain path after every write
+func TestControllerRemoveStaleOk(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tc := testCondCtrl{
+		rootKey: "/skydns",
+		DNSname: "kubemaster.local",
+		DNSTTL:  60,
+		informer: &infTest{
+			fakehostip: []string{"1.1.1.1", "1.1.1.2"},
+			fakeChan:   make(chan struct{}),
+			getDNSTestFunc: func() bool {
+				return true
+			},
+		},
+		leaser: &leaseTest{
+			fakeChan: make(chan struct{}),
+			startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+				return true
+			},
+			leaseRevokeRunFunc: func() bool {
+				return true
+			},
+		},
+	}
+
+	tc.leaser.removeStaleFunc = func(prefix string, entries []Entry) bool {
+		expectedPrefix := "/skydns/local/kubemaster/"
+
+		if prefix != expectedPrefix {
+			t.Errorf("Expected prefix %s but got %s", expectedPrefix, prefix)
+		}
+
+		if len(entries) != 2 || entries[1].Key != expectedPrefix+"x2" {
+			t.Errorf("Expected the desired entries to be kept but got %v", entries)
+		}
+
+		cancel()
+		return true
+	}
+
+	go RunController(ctx, tc.recordSet(), tc.leaser, tc.informer)
+
+	expectDone(ctx, t, "It should remove the stale keys")
+	cancel()
+}
+
+// Verify that a drift on the published keys triggers a reconcile
+func TestControllerDriftOk(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tc := testCondCtrl{
+		rootKey: "rootkey",
+		DNSname: "kubemaster.local",
+		DNSTTL:  10,
+		informer: &infTest{
+			fakehostip: []string{"2.2.1.11"},
+			fakeChan:   make(chan struct{}),
+		},
+		leaser: &leaseTest{
+			fakeChan:      make(chan struct{}),
+			fakeDriftChan: make(chan struct{}),
+			startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+				return true
+			},
+			leaseRevokeRunFunc: func() bool {
+				return true
+			},
+		},
+	}
+
+	//If the func runs a second time, the drift was reconciled
+	tc.informer.getDNSTestFunc = func() bool {
+
+		if tc.informer.readCount > 1 {
+			cancel()
+		}
+		return true
+	}
+
+	before := driftCorrections.Value()
+
+	go RunController(ctx, tc.recordSet(), tc.leaser, tc.informer)
+
+	sendSignal(t, tc.leaser.fakeDriftChan)
+
+	expectDone(ctx, t, "It should reconcile after the drift")
+
+	if driftCorrections.Value() != before+1 {
+		t.Errorf("Expected drift corrections %d but got %d", before+1, driftCorrections.Value())
+	}
+
+	cancel()
+}
+
+// expectDone - Wait for the test to cancel the context once the controller did what was expected
+func expectDone(ctx context.Context, t *testing.T, msg string) {
+	t.Helper()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error(msg)
+	}
+}
+
+// sendSignal - Hand the signal over once the controller waits for it
+func sendSignal(t *testing.T, ch chan struct{}) {
+	t.Helper()
+
+	select {
+	case ch <- struct{}{}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The controller is not waiting for the signal")
+	}
+}
+
+type infTest struct {
+	fakehostip     []string
+	err            error
+	fakeChan       chan struct{}
+	fakeCloseChan  chan struct{}
+	getDNSTestFunc func() bool
+	readCount      int
+}
+
+func (i *infTest) Start(ctx context.Context) {
+	//Not sure yet, what this should be doing
+}
+
+// GetDnsKeyVal - this is only for testing
+func (i *infTest) GetHostIPs(ctx context.Context) (hostip []string, err error) {
+
+	i.readCount++
+
+	if !i.getDNSTestFunc() {
+		return nil, i.err
+	}
+
+	return i.fakehostip, nil
+}
+
+// GetDnsKeyVal - this is only for testing
+func (i *infTest) GetInformerInterupt() (informerInterupted chan struct{}) {
+	return i.fakeChan
+}
+
+// GetDnsKeyVal - this is only for testing
+func (i *infTest) GetInformerErrorClose() (errClose chan struct{}) {
+	return i.fakeCloseChan
+}
+
+type leaseTest struct {
+	err                error
+	fakeChan           chan struct{}
+	startLeaseFunc     func(entries []Entry, leaseTimeInSec int) bool
+	leaseRevokeRunFunc func() bool
+	removeStaleFunc    func(prefix string, entries []Entry) bool
+	fakeDriftChan      chan struct{}
+}
+
+func (l *leaseTest) InitLease(ctx context.Context, entries []Entry, leaseTimeInSec int) error {
+
+	if l.startLeaseFunc(entries, leaseTimeInSec) {
+		return nil
+	}
+
+	return l.err
+
+}
+
+func (l *leaseTest) RemoveStale(ctx context.Context, prefix string, entries []Entry) error {
+
+	if l.removeStaleFunc == nil || l.removeStaleFunc(prefix, entries) {
+		return nil
+	}
+
+	return l.err
+}
+
+func (l *leaseTest) WatchDrift(ctx context.Context, prefix string, entries []Entry) error {
+	return nil
+}
+
+func (l *leaseTest) GetDriftChan() (driftDetected chan struct{}) {
+	return l.fakeDriftChan
+}
+
+func (l *leaseTest) GetRenewalInteruptChan() (renewalInterupted chan struct{}) {
+	return l.fakeChan
+}
+
+func (l *leaseTest) RevokeLease(ctx context.Context) error {
+	if !l.leaseRevokeRunFunc() {
+		return l.err
+	}
+
+	return nil
+}
+
+// Verify the controller tells the observers what replaced what and why
+func TestControllerObserver(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inf := &infTest{
+		fakehostip: []string{"10.0.0.1"},
+		fakeChan:   make(chan struct{}),
+		getDNSTestFunc: func() bool {
+			return true
+		},
+	}
+
+	observed := make(chan Publication, 2)
+	c := &Controller{
+		RecordSet: RecordSet{RootKey: "skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: DefaultOwnerID},
+		Lease: &leaseTest{
+			fakeChan: make(chan struct{}),
+			startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+				return true
+			},
+		},
+		Informer:  inf,
+		Observers: []Observer{observerFunc(func(p Publication) { observed <- p })},
+	}
+
+	go c.Run(ctx)
+
+	first := <-observed
+	if first.Trigger != TriggerStartup || first.Old != nil || !reflect.DeepEqual(first.New, []string{"10.0.0.1"}) {
+		t.Errorf("Unexpected first publication %+v", first)
+	}
+
+	inf.fakehostip = []string{"10.0.0.1", "10.0.0.2"}
+	inf.fakeChan <- struct{}{}
+
+	second := <-observed
+	if second.Trigger != TriggerInformer || !reflect.DeepEqual(second.Old, []string{"10.0.0.1"}) ||
+		!reflect.DeepEqual(second.New, []string{"10.0.0.1", "10.0.0.2"}) || second.Domain != "kubemaster.local" {
+		t.Errorf("Unexpected second publication %+v", second)
+	}
+}
+
+type observerFunc func(p Publication)
+
+func (f observerFunc) Published(ctx context.Context, p Publication) {
+	f(p)
+}
+
+// zoneInfTest - An informer telling the zones of its host ips
+type zoneInfTest struct {
+	*infTest
+	zones map[string]string
+}
+
+func (z *zoneInfTest) GetHostZones(ctx context.Context) (map[string]string, error) {
+	return z.zones, nil
+}
+
+// Verify the zone entries are published with the global set and only the global set is observed
+func TestControllerZones(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inf := &zoneInfTest{
+		infTest: &infTest{
+			fakehostip: []string{"10.0.0.1", "10.0.0.2"},
+			fakeChan:   make(chan struct{}),
+			getDNSTestFunc: func() bool {
+				return true
+			},
+		},
+		zones: map[string]string{"10.0.0.2": "us-east-1a"},
+	}
+
+	written := make(chan []Entry, 1)
+	lease := &leaseTest{
+		fakeChan: make(chan struct{}),
+		startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+			written <- entries
+			return true
+		},
+		leaseRevokeRunFunc: func() bool {
+			return true
+		},
+	}
+
+	rs := RecordSet{RootKey: "skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: DefaultOwnerID}
+	go RunController(ctx, rs, lease, inf)
+
+	var keys []string
+	select {
+	case entries := <-written:
+		for _, e := range entries {
+			keys = append(keys, e.Key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the entries to be written")
+	}
+
+	expected := []string{"/skydns/local/kubemaster/x1", "/skydns/local/kubemaster/x2", "/skydns/local/kubemaster/us-east-1a/x1"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected %v but got %v", expected, keys)
+	}
+}
@@ -0,0 +1,422 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/logging"
+	"github.com/tweakmy/fotofona/source"
+	"go.uber.org/zap"
+
+	v1Api "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// RecordSetController - Run an informer and lease pipeline for every MasterDNSRecord
+type RecordSetController struct {
+	client    dynamic.Interface
+	clientset kubernetes.Interface
+
+	//defaults - Root key, owner, ttl and lease of the flags, the spec overrides the ttl and the lease
+	defaults RecordSet
+
+	//newLease - One lease per pipeline, owned by the record
+	newLease func(ownerID string) LeaseInf
+
+	//newSource - One source per pipeline, a bare node informer when not set
+	newSource NewRecordSource
+
+	recorder  record.EventRecorder
+	observers []Observer
+
+	//Handed down to the pipelines, times the status conditions
+	clock clock.Clock
+
+	queue   workqueue.RateLimitingInterface
+	indexer cache.Indexer
+
+	//Running pipelines by record name, only touched by the single worker
+	pipelines map[string]*pipeline
+}
+
+// pipeline - Controller publishing one record
+type pipeline struct {
+	uid        types.UID
+	generation int64
+	prefix     string
+	lease      LeaseInf
+	cancel     context.CancelFunc
+	done       chan struct{}
+
+	//restarted - Started again after it stopped on its own, the record keeps backing off until published is closed
+	restarted bool
+	published chan struct{}
+}
+
+// NewRecordSetController - Watch the records and publish them with the defaults of the flags
+func NewRecordSetController(client dynamic.Interface, clientset kubernetes.Interface, defaults RecordSet,
+	newLease func(ownerID string) LeaseInf, recorder record.EventRecorder, observers []Observer) *RecordSetController {
+
+	return &RecordSetController{
+		client:    client,
+		clientset: clientset,
+		defaults:  defaults,
+		newLease:  newLease,
+		recorder:  recorder,
+		observers: observers,
+		clock:     clockutil.Default,
+		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		pipelines: map[string]*pipeline{},
+	}
+}
+
+// NewRecordSource - Build the source of a record from its selector and address types, the flags fill in the rest
+type NewRecordSource func(selector string, addressTypes []string) (InformerInf, error)
+
+// SetClock - Measure time on the clock instead of the real one, before the controller is run
+func (r *RecordSetController) SetClock(clk clock.Clock) {
+	r.clock = clk
+}
+
+// SetNewSource - Build the source of every record with newSource instead of a bare node informer, before the controller is run
+func (r *RecordSetController) SetNewSource(newSource NewRecordSource) {
+	r.newSource = newSource
+}
+
+// Run - Keep the pipelines in line with the records until the context is done
+func (r *RecordSetController) Run(ctx context.Context) {
+
+	log := logging.Logger(logging.ComponentController)
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(r.client, 0)
+	informer := factory.ForResource(masterDNSRecordGVR).Informer()
+	r.indexer = informer.GetIndexer()
+
+	enqueue := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err == nil {
+			r.queue.Add(key)
+		}
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) { enqueue(newObj) },
+		DeleteFunc: enqueue,
+	})
+
+	factory.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		log.Error("Timed out waiting for the MasterDNSRecord cache to sync")
+		return
+	}
+
+	log.Info("Watching MasterDNSRecord objects")
+
+	go clockutil.Until(r.clock, func() {
+		for r.processNextItem(ctx) {
+		}
+	}, time.Second, ctx.Done())
+
+	//The pipelines run under the same context and stop on their own, their leases expire
+	<-ctx.Done()
+	r.queue.ShutDown()
+	log.Info("Stop watching MasterDNSRecord objects")
+}
+
+func (r *RecordSetController) processNextItem(ctx context.Context) bool {
+
+	key, quit := r.queue.Get()
+	if quit {
+		return false
+	}
+	defer r.queue.Done(key)
+
+	if err := r.sync(ctx, key.(string)); err != nil {
+		logging.Logger(logging.ComponentController).Error("Could not sync the record", zap.String("record", key.(string)), zap.Error(err))
+		r.queue.AddRateLimited(key)
+		return true
+	}
+
+	//A pipeline stopping over and over is restarted less and less often, until it publishes again
+	if p, ok := r.pipelines[key.(string)]; ok && p.restarted {
+		select {
+		case <-p.published:
+			p.restarted = false
+		default:
+			return true
+		}
+	}
+
+	r.queue.Forget(key)
+	return true
+}
+
+// sync - Start, restart or tear down the pipeline of the record
+func (r *RecordSetController) sync(ctx context.Context, name string) error {
+
+	log := logging.Logger(logging.ComponentController).With(zap.String("record", name))
+
+	obj, exists, err := r.indexer.GetByKey(name)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		log.Info("Record deleted, removing its entries")
+		r.teardown(name, true)
+		return nil
+	}
+
+	rec, err := decodeMasterDNSRecord(obj.(*unstructured.Unstructured))
+	if err != nil {
+		return err
+	}
+
+	//Status updates do not change the generation
+	p, running := r.pipelines[name]
+	restart := false
+	if running && p.uid == rec.UID && p.generation == rec.Generation {
+		select {
+		case <-p.done:
+			//The controller gave up on its own, same record so same prefix
+			log.Info("Pipeline stopped, restarting it")
+			restart = true
+		default:
+			return nil
+		}
+	}
+
+	rs, err := rec.recordSet(r.defaults)
+	if err != nil {
+		log.Error("Invalid record", zap.Error(err))
+		r.teardown(name, true)
+		if r.recorder != nil {
+			r.recorder.Event(rec.objectReference(), v1Api.EventTypeWarning, reasonInvalidSpec, err.Error())
+		}
+
+		status := rec.Status
+		status.ObservedGeneration = rec.Generation
+		status.PublishedIPs = nil
+		status.setCondition(MasterDNSRecordCondition{
+			Type:               conditionPublished,
+			Status:             v1Api.ConditionFalse,
+			Reason:             reasonInvalidSpec,
+			Message:            err.Error(),
+			LastTransitionTime: metaV1.NewTime(r.clock.Now()),
+		})
+		return patchStatus(r.client, name, status)
+	}
+
+	//The entries moving to another prefix have to go now, otherwise the new lease takes them over
+	r.teardown(name, running && p.prefix != rs.Prefix())
+
+	log.Info("Starting the pipeline", zap.String("domain", rs.DomainName), zap.Int64("generation", rec.Generation))
+	return r.start(ctx, rec, rs, restart)
+}
+
+// nodeInformer - Source of the record when none is set, the nodes matching the selector
+func (r *RecordSetController) nodeInformer(selector string, addressTypes []string) (InformerInf, error) {
+	inf := source.NewInformer(selector, r.clientset)
+	inf.SetAddressTypes(addressTypes)
+	inf.SetClock(r.clock)
+	if r.recorder != nil {
+		inf.SetEventRecorder(r.recorder)
+	}
+	return inf, nil
+}
+
+// start - Run the source and the lease of the record, a restarted one is queued again once it published
+func (r *RecordSetController) start(ctx context.Context, rec *MasterDNSRecord, rs RecordSet, restarted bool) error {
+
+	newSource := r.newSource
+	if newSource == nil {
+		newSource = r.nodeInformer
+	}
+
+	inf, err := newSource(rec.Spec.Selector, rec.Spec.AddressTypes)
+	if err != nil {
+		return err
+	}
+
+	pctx, cancel := context.WithCancel(ctx)
+
+	lease := r.newLease(rs.OwnerID)
+
+	status := &statusObserver{
+		client:     r.client,
+		name:       rec.Name,
+		generation: rec.Generation,
+		status:     rec.Status,
+		clock:      r.clock,
+	}
+
+	observers := append([]Observer{status}, r.observers...)
+
+	published := make(chan struct{})
+	if restarted {
+		observers = append(observers, &firstPublication{published: published, requeue: func() { r.queue.Add(rec.Name) }})
+	}
+
+	c := &Controller{
+		RecordSet:   rs,
+		Lease:       lease,
+		Informer:    inf,
+		Recorder:    r.recorder,
+		EventObject: rec.objectReference(),
+		Observers:   observers,
+		Clock:       r.clock,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Run(pctx)
+
+		//Stopped on its own rather than torn down, the record is not published until the pipeline is back
+		stopped := pctx.Err() == nil
+		if stopped {
+			status.Failed(pctx, reasonPipelineStopped, fmt.Sprintf("Publishing %s stopped, restarting the pipeline", rs.DomainName))
+		}
+
+		//Closed before the record is queued again, the worker has to see the pipeline stopped
+		close(done)
+		if stopped {
+			r.queue.AddRateLimited(rec.Name)
+		}
+	}()
+
+	r.pipelines[rec.Name] = &pipeline{
+		uid:        rec.UID,
+		generation: rec.Generation,
+		prefix:     rs.Prefix(),
+		lease:      lease,
+		cancel:     cancel,
+		done:       done,
+		restarted:  restarted,
+		published:  published,
+	}
+	return nil
+}
+
+// teardown - Stop the pipeline of the record, revoking the lease removes its entries right away
+func (r *RecordSetController) teardown(name string, revoke bool) {
+
+	p, ok := r.pipelines[name]
+	if !ok {
+		return
+	}
+
+	p.cancel()
+	<-p.done
+	delete(r.pipelines, name)
+
+	//Run closed it already, a pipeline that never got to run has to be closed here
+	if cl, ok := p.lease.(ClosingLeaseInf); ok {
+		cl.Close()
+	}
+
+	if !revoke {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := p.lease.RevokeLease(ctx); err != nil {
+		logging.Logger(logging.ComponentController).Error("Could not revoke the lease", zap.String("record", name), zap.Error(err))
+	}
+}
+
+// firstPublication - Close published and queue the record on the first publication of a restarted pipeline,
+// the worker forgets its back off then
+type firstPublication struct {
+	once      sync.Once
+	published chan struct{}
+	requeue   func()
+}
+
+// Published - The restarted pipeline is good again
+func (f *firstPublication) Published(ctx context.Context, p Publication) {
+	f.once.Do(func() {
+		close(f.published)
+		f.requeue()
+	})
+}
+
+// statusObserver - Report the published host ips and the failures in the status of the record
+type statusObserver struct {
+	client     dynamic.Interface
+	name       string
+	generation int64
+	clock      clock.Clock
+
+	mu     sync.Mutex
+	status MasterDNSRecordStatus
+}
+
+// Published - The host ips are served
+func (s *statusObserver) Published(ctx context.Context, p Publication) {
+	s.update(func(status *MasterDNSRecordStatus) {
+		status.PublishedIPs = p.New
+		status.setCondition(MasterDNSRecordCondition{
+			Type:               conditionPublished,
+			Status:             v1Api.ConditionTrue,
+			Reason:             conditionPublished,
+			Message:            fmt.Sprintf("%d host ips published on %s", len(p.New), p.Trigger),
+			LastTransitionTime: metaV1.NewTime(p.Time),
+		})
+	})
+}
+
+// Failed - The host ips may no longer be served
+func (s *statusObserver) Failed(ctx context.Context, reason string, message string) {
+	s.update(func(status *MasterDNSRecordStatus) {
+		status.setCondition(MasterDNSRecordCondition{
+			Type:               conditionPublished,
+			Status:             v1Api.ConditionFalse,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: metaV1.NewTime(clockutil.OrDefault(s.clock).Now()),
+		})
+	})
+}
+
+func (s *statusObserver) update(change func(status *MasterDNSRecordStatus)) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(&s.status)
+	s.status.ObservedGeneration = s.generation
+
+	if err := patchStatus(s.client, s.name, s.status); err != nil {
+		logging.Logger(logging.ComponentController).Error("Could not update the status", zap.String("record", s.name), zap.Error(err))
+	}
+}
+
+// patchStatus - Replace the status subresource of the record
+// A JSON patch, custom resources take no strategic merge patch and the fake client no merge patch
+func patchStatus(client dynamic.Interface, name string, status MasterDNSRecordStatus) error {
+
+	patch, err := json.Marshal([]map[string]interface{}{{"op": "add", "path": "/status", "value": status}})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Resource(masterDNSRecordGVR).Patch(name, types.JSONPatchType, patch, metaV1.UpdateOptions{}, "status")
+	return err
+}
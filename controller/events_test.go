@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/testutil"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+)
+
+// Verify the lease and write failures end up as events on the event object
+func TestControllerFailureEvents(t *testing.T) {
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{err: errors.New("etcdserver: request timed out"), expected: "Warning LeaseFailed Could not publish kubemaster.local: etcdserver: request timed out"},
+		{err: &WriteError{Key: "/skydns/local/kubemaster/x1", Err: errors.New("permission denied")}, expected: "Warning EtcdWriteFailed Could not publish kubemaster.local: could not write /skydns/local/kubemaster/x1: permission denied"},
+	}
+
+	for _, tt := range tests {
+
+		recorder := record.NewFakeRecorder(10)
+		clk := clock.NewFakeClock(time.Now())
+
+		c := &Controller{
+			RecordSet: RecordSet{RootKey: "skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: DefaultOwnerID},
+			Lease: &leaseTest{
+				err: tt.err,
+				startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+					return false
+				},
+			},
+			Informer: &infTest{
+				fakehostip: []string{"1.1.1.1"},
+				fakeChan:   make(chan struct{}),
+				getDNSTestFunc: func() bool {
+					return true
+				},
+			},
+			Recorder:    recorder,
+			EventObject: &v1.ObjectReference{Kind: "Pod", Namespace: "kube-system", Name: "fotofona-0"},
+			Clock:       clk,
+		}
+
+		done := make(chan struct{})
+		go testutil.AdvanceWhileWaiting(clk, RetryBackoff, done)
+
+		//Gives up after the third attempt
+		c.Run(context.Background())
+		close(done)
+
+		testutil.ExpectEvents(t, recorder, tt.expected, tt.expected, tt.expected)
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+
+	v1Api "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// masterDNSRecordGVR - Cluster scoped resource declared in deploy/crd.yaml
+var masterDNSRecordGVR = schema.GroupVersionResource{
+	Group:    "fotofona.io",
+	Version:  "v1alpha1",
+	Resource: "masterdnsrecords",
+}
+
+// masterDNSRecordKind - Kind of the custom resource
+const masterDNSRecordKind = "MasterDNSRecord"
+
+// conditionPublished - True once the host ips of the record are published
+const conditionPublished = "Published"
+
+// reasonInvalidSpec - The spec could not be turned into a record set
+const reasonInvalidSpec = "InvalidSpec"
+
+// reasonPipelineStopped - The controller of the record gave up, the pipeline is restarted with a backoff
+const reasonPipelineStopped = "PipelineStopped"
+
+// MasterDNSRecord - Declare a record set as a kubernetes object instead of the flags
+type MasterDNSRecord struct {
+	metaV1.TypeMeta   `json:",inline"`
+	metaV1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MasterDNSRecordSpec   `json:"spec"`
+	Status MasterDNSRecordStatus `json:"status,omitempty"`
+}
+
+// MasterDNSRecordSpec - Which nodes are published under which domain
+type MasterDNSRecordSpec struct {
+	//Selector - Label selector of the nodes, like --watchlabels
+	Selector string `json:"selector"`
+
+	//Domain - Dns name resolving to the node addresses
+	Domain string `json:"domain"`
+
+	//TTL - Dns TTL in seconds, --ttl when not set
+	TTL int `json:"ttl,omitempty"`
+
+	//LeaseTTL - Lease in seconds holding the entries, --lease-ttl when not set
+	LeaseTTL int `json:"leaseTTL,omitempty"`
+
+	//AddressTypes - Node address types in order of preference, --nodes-address-types when not set
+	AddressTypes []string `json:"addressTypes,omitempty"`
+
+	//RecordTypes - A, AAAA or both when not set
+	RecordTypes []string `json:"recordTypes,omitempty"`
+}
+
+// MasterDNSRecordStatus - What was published for the spec
+type MasterDNSRecordStatus struct {
+	ObservedGeneration int64                      `json:"observedGeneration,omitempty"`
+	PublishedIPs       []string                   `json:"publishedIPs"`
+	Conditions         []MasterDNSRecordCondition `json:"conditions,omitempty"`
+}
+
+// MasterDNSRecordCondition - Latest observation of one aspect of the record
+type MasterDNSRecordCondition struct {
+	Type               string                `json:"type"`
+	Status             v1Api.ConditionStatus `json:"status"`
+	Reason             string                `json:"reason,omitempty"`
+	Message            string                `json:"message,omitempty"`
+	LastTransitionTime metaV1.Time           `json:"lastTransitionTime,omitempty"`
+}
+
+// decodeMasterDNSRecord - Read the typed record out of the dynamic object
+func decodeMasterDNSRecord(u *unstructured.Unstructured) (*MasterDNSRecord, error) {
+
+	b, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	var r MasterDNSRecord
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// recordSet - Fill the spec with the defaults from the flags and validate it
+func (r *MasterDNSRecord) recordSet(defaults RecordSet) (RecordSet, error) {
+
+	spec := r.Spec
+
+	if !govalidator.IsDNSName(spec.Domain) {
+		return RecordSet{}, fmt.Errorf("domain: %q should use qualified domain name", spec.Domain)
+	}
+
+	if _, err := labels.Parse(spec.Selector); err != nil {
+		return RecordSet{}, fmt.Errorf("selector: %s", err.Error())
+	}
+
+	for _, t := range spec.AddressTypes {
+		if t != string(v1Api.NodeInternalIP) && t != string(v1Api.NodeExternalIP) {
+			return RecordSet{}, fmt.Errorf("addressTypes: %q must be %s or %s", t, v1Api.NodeInternalIP, v1Api.NodeExternalIP)
+		}
+	}
+
+	rs := RecordSet{
+		Name:        r.Name,
+		RootKey:     defaults.RootKey,
+		DomainName:  spec.Domain,
+		TTL:         defaults.TTL,
+		LeaseTTL:    defaults.LeaseTTL,
+		OwnerID:     r.ownerID(defaults.OwnerID),
+		RecordTypes: spec.RecordTypes,
+		Weight:      defaults.Weight,
+	}
+
+	if spec.TTL != 0 {
+		rs.TTL = spec.TTL
+		//The lease of the flags may not fit the ttl of the record, derive it instead
+		rs.LeaseTTL = 0
+	}
+	if spec.LeaseTTL != 0 {
+		rs.LeaseTTL = spec.LeaseTTL
+	}
+
+	if err := rs.Validate(); err != nil {
+		//The flag names mean nothing to whoever wrote the record
+		msg := strings.Replace(err.Error(), "--lease-ttl", "leaseTTL", -1)
+		return RecordSet{}, errors.New(strings.Replace(msg, "--ttl", "ttl", -1))
+	}
+
+	return rs, nil
+}
+
+// ownerID - Every record owns its keys, two records sharing a domain never remove each other's
+func (r *MasterDNSRecord) ownerID(base string) string {
+	return fmt.Sprintf("%s/%s", base, r.Name)
+}
+
+// objectReference - Where the events of the record go
+func (r *MasterDNSRecord) objectReference() *v1Api.ObjectReference {
+	return &v1Api.ObjectReference{
+		Kind:       masterDNSRecordKind,
+		APIVersion: masterDNSRecordGVR.GroupVersion().String(),
+		Name:       r.Name,
+		UID:        r.UID,
+	}
+}
+
+// setCondition - Replace the condition of the same type, keep the transition time when the status stays
+func (s *MasterDNSRecordStatus) setCondition(c MasterDNSRecordCondition) {
+
+	for i := range s.Conditions {
+		if s.Conditions[i].Type != c.Type {
+			continue
+		}
+		if s.Conditions[i].Status == c.Status {
+			c.LastTransitionTime = s.Conditions[i].LastTransitionTime
+		}
+		s.Conditions[i] = c
+		return
+	}
+
+	s.Conditions = append(s.Conditions, c)
+}
@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newMasterDNSRecord(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "fotofona.io/v1alpha1",
+		"kind":       masterDNSRecordKind,
+		"metadata": map[string]interface{}{
+			"name":       name,
+			"uid":        "1234",
+			"generation": int64(2),
+		},
+		"spec": spec,
+	}}
+}
+
+// Verify the spec turns into the record set with the defaults of the flags
+func TestMasterDNSRecordRecordSet(t *testing.T) {
+
+	defaults := RecordSet{RootKey: "/skydns", TTL: 60, LeaseTTL: 20, OwnerID: DefaultOwnerID}
+
+	tests := []struct {
+		spec     map[string]interface{}
+		expected RecordSet
+		wantErr  bool
+	}{
+		{
+			spec:     map[string]interface{}{"selector": "node-role.kubernetes.io/master=", "domain": "kubemaster.local"},
+			expected: RecordSet{Name: "kubemaster", RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 60, LeaseTTL: 20, OwnerID: "fotofona/kubemaster"},
+		},
+		{
+			spec: map[string]interface{}{"domain": "kubemaster.local", "ttl": int64(10), "recordTypes": []interface{}{"AAAA"}},
+			expected: RecordSet{Name: "kubemaster", RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 10, OwnerID: "fotofona/kubemaster",
+				RecordTypes: []string{"AAAA"}},
+		},
+		{
+			spec:     map[string]interface{}{"domain": "kubemaster.local", "ttl": int64(10), "leaseTTL": int64(8)},
+			expected: RecordSet{Name: "kubemaster", RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 10, LeaseTTL: 8, OwnerID: "fotofona/kubemaster"},
+		},
+		{spec: map[string]interface{}{"domain": "not a domain"}, wantErr: true},
+		{spec: map[string]interface{}{"domain": "kubemaster.local", "ttl": int64(10), "leaseTTL": int64(30)}, wantErr: true},
+		{spec: map[string]interface{}{"domain": "kubemaster.local", "addressTypes": []interface{}{"Hostname"}}, wantErr: true},
+		{spec: map[string]interface{}{"domain": "kubemaster.local", "recordTypes": []interface{}{"CNAME"}}, wantErr: true},
+	}
+
+	for i, tt := range tests {
+
+		rec, err := decodeMasterDNSRecord(newMasterDNSRecord("kubemaster", tt.spec))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rs, err := rec.recordSet(defaults)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("test %d: expected an error but got %+v", i, rs)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(rs, tt.expected) {
+			t.Errorf("test %d: expected %+v but got %+v", i, tt.expected, rs)
+		}
+	}
+}
+
+func TestRecordSetFilterIPs(t *testing.T) {
+
+	ips := []string{"10.0.0.1", "fd00::1", "10.0.0.2"}
+
+	tests := []struct {
+		recordTypes []string
+		expected    []string
+	}{
+		{recordTypes: nil, expected: ips},
+		{recordTypes: []string{RecordTypeA}, expected: []string{"10.0.0.1", "10.0.0.2"}},
+		{recordTypes: []string{RecordTypeAAAA}, expected: []string{"fd00::1"}},
+		{recordTypes: []string{RecordTypeA, RecordTypeAAAA}, expected: ips},
+	}
+
+	for _, tt := range tests {
+		got := RecordSet{RecordTypes: tt.recordTypes}.FilterIPs(ips)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %q but got %q", tt.recordTypes, tt.expected, got)
+		}
+	}
+}
+
+func TestMasterDNSRecordSetCondition(t *testing.T) {
+
+	first := metaV1.NewTime(time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC))
+	later := metaV1.NewTime(first.Add(time.Hour))
+
+	status := MasterDNSRecordStatus{}
+	status.setCondition(MasterDNSRecordCondition{Type: conditionPublished, Status: v1.ConditionTrue, LastTransitionTime: first})
+	status.setCondition(MasterDNSRecordCondition{Type: conditionPublished, Status: v1.ConditionTrue, Message: "again", LastTransitionTime: later})
+
+	if len(status.Conditions) != 1 || !status.Conditions[0].LastTransitionTime.Equal(&first) || status.Conditions[0].Message != "again" {
+		t.Errorf("Expected the transition time to stay while the status stays, got %+v", status.Conditions)
+	}
+
+	status.setCondition(MasterDNSRecordCondition{Type: conditionPublished, Status: v1.ConditionFalse, LastTransitionTime: later})
+	if !status.Conditions[0].LastTransitionTime.Equal(&later) {
+		t.Errorf("Expected the transition time to move with the status, got %+v", status.Conditions)
+	}
+}
+
+// Verify the published host ips and the failures end up in the status
+func TestStatusObserver(t *testing.T) {
+
+	obj := newMasterDNSRecord("kubemaster", map[string]interface{}{"domain": "kubemaster.local"})
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj)
+
+	s := &statusObserver{client: client, name: "kubemaster", generation: 2}
+
+	s.Published(context.Background(), Publication{Time: time.Now(), Domain: "kubemaster.local", Trigger: TriggerStartup,
+		New: []string{"10.0.0.1", "10.0.0.2"}})
+	s.Failed(context.Background(), ReasonLeaseFailed, "Lease holding kubemaster.local was lost, granting a new one")
+
+	got, err := client.Resource(masterDNSRecordGVR).Get("kubemaster", metaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := decodeMasterDNSRecord(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(rec.Status.PublishedIPs, []string{"10.0.0.1", "10.0.0.2"}) || rec.Status.ObservedGeneration != 2 {
+		t.Errorf("Unexpected status %+v", rec.Status)
+	}
+
+	if len(rec.Status.Conditions) != 1 || rec.Status.Conditions[0].Status != v1.ConditionFalse ||
+		rec.Status.Conditions[0].Reason != ReasonLeaseFailed {
+		t.Errorf("Unexpected conditions %+v", rec.Status.Conditions)
+	}
+}
+
+// Verify a pipeline stopped on its own is started again, a running one is left alone
+func TestRecordSetControllerRestart(t *testing.T) {
+
+	obj := newMasterDNSRecord("kubemaster", map[string]interface{}{"domain": "kubemaster.local"})
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj)
+
+	//Nothing gets published until released
+	release := make(chan struct{})
+	newLease := func(ownerID string) LeaseInf {
+		return &leaseTest{
+			startLeaseFunc:     func(entries []Entry, leaseTimeInSec int) bool { <-release; return true },
+			leaseRevokeRunFunc: func() bool { return true },
+		}
+	}
+
+	defaults := RecordSet{RootKey: "/skydns", TTL: 10, OwnerID: DefaultOwnerID}
+	r := NewRecordSetController(client, fake.NewSimpleClientset(), defaults, newLease, nil, nil)
+	r.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := r.indexer.Add(obj); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	running := &pipeline{uid: "1234", generation: 2, prefix: "/skydns/local/kubemaster/", lease: newLease(""),
+		cancel: func() {}, done: make(chan struct{})}
+	r.pipelines["kubemaster"] = running
+
+	if err := r.sync(ctx, "kubemaster"); err != nil {
+		t.Fatal(err)
+	}
+	if r.pipelines["kubemaster"] != running {
+		t.Fatal("Expected the running pipeline to be left alone")
+	}
+
+	close(running.done)
+	if err := r.sync(ctx, "kubemaster"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := r.pipelines["kubemaster"]
+	if restarted == running || !restarted.restarted {
+		t.Fatalf("Expected the stopped pipeline to be restarted, got %+v", restarted)
+	}
+	select {
+	case <-restarted.done:
+		t.Error("Expected the restarted pipeline to be running")
+	default:
+	}
+
+	//Still backing off until the restarted pipeline publishes
+	r.queue.AddRateLimited("kubemaster")
+	r.processNextItem(ctx)
+	if !restarted.restarted || r.queue.NumRequeues("kubemaster") != 1 {
+		t.Errorf("Expected the record to keep backing off, restarted %t requeues %d", restarted.restarted, r.queue.NumRequeues("kubemaster"))
+	}
+
+	close(release)
+
+	select {
+	case <-restarted.published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the restarted pipeline to publish")
+	}
+
+	//Queued again by the publication, the back off is forgotten
+	r.processNextItem(ctx)
+	if restarted.restarted || r.queue.NumRequeues("kubemaster") != 0 {
+		t.Errorf("Expected the back off to be forgotten, restarted %t requeues %d", restarted.restarted, r.queue.NumRequeues("kubemaster"))
+	}
+
+	r.teardown("kubemaster", false)
+}
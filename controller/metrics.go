@@ -0,0 +1,8 @@
+package controller
+
+import (
+	"expvar"
+)
+
+// driftCorrections - Number of reconcile triggered because the published keys drifted
+var driftCorrections = expvar.NewInt("drift_corrections")
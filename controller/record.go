@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"encoding/json"
+)
+
+// Entry - Key Val entry for dns entry
+type Entry struct {
+	Key string
+	Val string
+}
+
+// DefaultOwnerID - Owner marker written into every value published by fotofona, see --owner-id
+const DefaultOwnerID = "fotofona"
+
+// Record - SkyDNS value stored for each entry, CoreDNS ignores the fields it does not know
+type Record struct {
+	Host      string `json:"host"`
+	TTL       int    `json:"ttl"`
+	Weight    int    `json:"weight,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	RecordSet string `json:"recordset,omitempty"`
+}
+
+// String - Encode the record the way it is written into etcd
+func (r Record) String() string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// DecodeRecord - Read back the value stored in etcd
+func DecodeRecord(val []byte) (Record, error) {
+	var r Record
+	err := json.Unmarshal(val, &r)
+	return r, err
+}
+
+// IsOwnedBy - Only the value carrying the same owner marker belongs to us
+func IsOwnedBy(val []byte, ownerID string) bool {
+	r, err := DecodeRecord(val)
+	if err != nil {
+		return false
+	}
+	return r.Owner != "" && r.Owner == ownerID
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Verify only values carrying our owner marker are treated as ours
+func TestRecordIsOwnedBy(t *testing.T) {
+
+	testCases := []struct {
+		val      string
+		expected bool
+	}{
+		{val: `{"host":"1.1.1.1","ttl":60,"owner":"fotofona"}`, expected: true},
+		{val: `{"host":"1.1.1.1","ttl":60,"owner":"someone"}`, expected: false},
+		{val: `{"host":"1.1.1.1","ttl":60}`, expected: false},
+		{val: `not a json`, expected: false},
+	}
+
+	for i, tc := range testCases {
+		if outcome := IsOwnedBy([]byte(tc.val), DefaultOwnerID); outcome != tc.expected {
+			t.Errorf("test item %d expected %t but outcome %t", i, tc.expected, outcome)
+		}
+	}
+
+	expectedVal := `{"host":"1.1.1.1","ttl":60,"owner":"fotofona"}`
+	if outcome := (Record{Host: "1.1.1.1", TTL: 60, Owner: DefaultOwnerID}).String(); outcome != expectedVal {
+		t.Errorf("Expected value %s but outcome %s", expectedVal, outcome)
+	}
+}
+
+// Verify the entries carry the owner and the record set name
+func TestRecordSetBuildEntries(t *testing.T) {
+
+	rs := RecordSet{
+		RootKey:    "/skydns/",
+		DomainName: "kubemaster.local",
+		TTL:        30,
+		OwnerID:    "cluster-a",
+	}
+
+	entries := BuildEntries(rs, []string{"10.0.0.1", "10.0.0.2"})
+
+	expected := []Entry{
+		Entry{Key: "/skydns/local/kubemaster/x1", Val: `{"host":"10.0.0.1","ttl":30,"owner":"cluster-a","recordset":"kubemaster.local"}`},
+		Entry{Key: "/skydns/local/kubemaster/x2", Val: `{"host":"10.0.0.2","ttl":30,"owner":"cluster-a","recordset":"kubemaster.local"}`},
+	}
+
+	if len(entries) != len(expected) {
+		t.Errorf("Expected %d entries but got %v", len(expected), entries)
+		return
+	}
+
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("test item %d expected %v but outcome %v", i, expected[i], entries[i])
+		}
+	}
+}
+
+// Verify the host ips are grouped by zone below the domain, the ones without a zone are left out
+func TestRecordSetBuildZoneEntries(t *testing.T) {
+
+	rs := RecordSet{
+		RootKey:    "/skydns/",
+		DomainName: "kubemaster.local",
+		TTL:        30,
+		OwnerID:    "cluster-a",
+	}
+
+	zones := map[string]string{
+		"10.0.0.1": "us-east-1b",
+		"10.0.0.2": "us-east-1a",
+		"10.0.0.3": "us-east-1b",
+		"10.0.0.5": "Zone_C.",
+		"10.0.0.6": "--",
+	}
+
+	entries := BuildZoneEntries(rs, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}, zones, nil)
+
+	expected := []Entry{
+		{Key: "/skydns/local/kubemaster/us-east-1a/x1", Val: `{"host":"10.0.0.2","ttl":30,"owner":"cluster-a","recordset":"kubemaster.local"}`},
+		{Key: "/skydns/local/kubemaster/us-east-1b/x1", Val: `{"host":"10.0.0.1","ttl":30,"owner":"cluster-a","recordset":"kubemaster.local"}`},
+		{Key: "/skydns/local/kubemaster/us-east-1b/x2", Val: `{"host":"10.0.0.3","ttl":30,"owner":"cluster-a","recordset":"kubemaster.local"}`},
+		{Key: "/skydns/local/kubemaster/zone-c/x1", Val: `{"host":"10.0.0.5","ttl":30,"owner":"cluster-a","recordset":"kubemaster.local"}`},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v but got %v", expected, entries)
+	}
+
+	if entries := BuildZoneEntries(rs, []string{"10.0.0.1"}, nil, nil); len(entries) != 0 {
+		t.Errorf("Expected no zone entries without zones but got %v", entries)
+	}
+}
+
+// Verify a host ip has its own weight or the one of the record set, 0 leaves the field out
+func TestRecordSetBuildWeightedEntries(t *testing.T) {
+
+	rs := RecordSet{
+		RootKey:    "/skydns/",
+		DomainName: "kubemaster.local",
+		TTL:        30,
+		OwnerID:    "cluster-a",
+		Weight:     100,
+	}
+
+	entries := BuildWeightedEntries(rs, []string{"10.0.0.1", "10.0.0.2"}, map[string]int{"10.0.0.2": 300})
+
+	expected := []Entry{
+		{Key: "/skydns/local/kubemaster/x1", Val: `{"host":"10.0.0.1","ttl":30,"weight":100,"owner":"cluster-a","recordset":"kubemaster.local"}`},
+		{Key: "/skydns/local/kubemaster/x2", Val: `{"host":"10.0.0.2","ttl":30,"weight":300,"owner":"cluster-a","recordset":"kubemaster.local"}`},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v but got %v", expected, entries)
+	}
+
+	rs.Weight = 0
+	entries = BuildWeightedEntries(rs, []string{"10.0.0.1"}, nil)
+	if expectedVal := `{"host":"10.0.0.1","ttl":30,"owner":"cluster-a","recordset":"kubemaster.local"}`; entries[0].Val != expectedVal {
+		t.Errorf("Expected value %s but outcome %s", expectedVal, entries[0].Val)
+	}
+}
+
+// Verify the ttl and lease combination is validated
+func TestRecordSetValidate(t *testing.T) {
+
+	testCases := []struct {
+		ttl           int
+		leaseTTL      int
+		weight        int
+		expectedLease int
+		expectedErr   bool
+	}{
+		{ttl: 60, leaseTTL: 0, expectedLease: 30},
+		{ttl: 5, leaseTTL: 0, expectedLease: 2},
+		{ttl: 5, leaseTTL: 5, expectedLease: 5},
+		{ttl: 300, leaseTTL: 20, expectedLease: 20},
+		{ttl: 0, leaseTTL: 0, expectedErr: true},
+		{ttl: 60, leaseTTL: -1, expectedErr: true},
+		{ttl: 60, leaseTTL: 1, expectedErr: true},
+		{ttl: 5, leaseTTL: 10, expectedErr: true},
+		{ttl: 60, weight: 65535, expectedLease: 30},
+		{ttl: 60, weight: -1, expectedErr: true},
+		{ttl: 60, weight: 65536, expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		rs := RecordSet{DomainName: "kubemaster.local", TTL: tc.ttl, LeaseTTL: tc.leaseTTL, Weight: tc.weight}
+
+		err := rs.Validate()
+		if (err != nil) != tc.expectedErr {
+			t.Errorf("test item %d expected error %t but outcome %v", i, tc.expectedErr, err)
+			continue
+		}
+
+		if !tc.expectedErr && rs.LeaseTime() != tc.expectedLease {
+			t.Errorf("test item %d expected lease %d but outcome %d", i, tc.expectedLease, rs.LeaseTime())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+)
+
+// Dns record types CoreDNS answers from the host ips
+const (
+	RecordTypeA    = "A"
+	RecordTypeAAAA = "AAAA"
+)
+
+// MaxWeight - SkyDNS weight is the 16 bit SRV weight
+const MaxWeight = 65535
+
+// MinLeaseTTL - Etcd does not grant anything shorter, keepalive needs some room to refresh
+const MinLeaseTTL = 2
+
+// RecordSet - Group of dns entries published under one domain name
+type RecordSet struct {
+	//Name - Identify the record set in the owner registry, default to the domain name
+	Name string
+
+	//RootKey - Etcd root path where coreDNS look for the domain
+	RootKey string
+
+	//DomainName - Dns name resolving to the host ips
+	DomainName string
+
+	//TTL - Dns TTL in seconds written into every entry, overrides --ttl
+	TTL int
+
+	//LeaseTTL - Lease in seconds holding the entries, overrides --lease-ttl, 0 derive it from TTL
+	LeaseTTL int
+
+	//OwnerID - Mark the entries so we never touch what others wrote
+	OwnerID string
+
+	//RecordTypes - A for the ipv4 and AAAA for the ipv6 host ips, empty publish both
+	RecordTypes []string
+
+	//Weight - SkyDNS weight of the host ips without a weight of their own, 0 leaves the field out
+	Weight int
+}
+
+// Prefix - Etcd directory holding the entries of the record set
+func (rs RecordSet) Prefix() string {
+	return DomainPrefix(rs.RootKey, rs.DomainName)
+}
+
+// LeaseTime - Lease in seconds to hold the entries
+func (rs RecordSet) LeaseTime() int {
+	if rs.LeaseTTL > 0 {
+		return rs.LeaseTTL
+	}
+	return calcLeaseTime(rs.TTL)
+}
+
+// FilterIPs - Keep the host ips served by the record types
+func (rs RecordSet) FilterIPs(hostips []string) []string {
+
+	if len(rs.RecordTypes) == 0 {
+		return hostips
+	}
+
+	wanted := map[string]bool{}
+	for _, t := range rs.RecordTypes {
+		wanted[t] = true
+	}
+
+	filtered := []string{}
+	for _, ip := range hostips {
+		parsed := net.ParseIP(ip)
+		switch {
+		case parsed == nil:
+			continue
+		case parsed.To4() != nil && wanted[RecordTypeA]:
+			filtered = append(filtered, ip)
+		case parsed.To4() == nil && wanted[RecordTypeAAAA]:
+			filtered = append(filtered, ip)
+		}
+	}
+
+	return filtered
+}
+
+// Validate - Make sure the dns TTL and the lease make sense together
+func (rs RecordSet) Validate() error {
+
+	for _, t := range rs.RecordTypes {
+		if t != RecordTypeA && t != RecordTypeAAAA {
+			return fmt.Errorf("recordTypes: %q must be %s or %s", t, RecordTypeA, RecordTypeAAAA)
+		}
+	}
+
+	if rs.Weight < 0 || rs.Weight > MaxWeight {
+		return fmt.Errorf("--default-weight: must be between 0 and %d, got %d", MaxWeight, rs.Weight)
+	}
+
+	if rs.TTL < 1 {
+		return fmt.Errorf("--ttl: must be at least 1 second, got %d", rs.TTL)
+	}
+
+	if rs.LeaseTTL < 0 {
+		return fmt.Errorf("--lease-ttl: must not be negative, got %d", rs.LeaseTTL)
+	}
+
+	if rs.LeaseTTL == 0 {
+		if rs.LeaseTime() < MinLeaseTTL {
+			logging.Logger(logging.ComponentCmd).Warn("Lease derived from --ttl is raised by etcd to the minimum",
+				zap.Int("leaseTTL", rs.LeaseTime()), zap.Int("ttl", rs.TTL), zap.Int("MinLeaseTTL", MinLeaseTTL))
+		}
+		return nil
+	}
+
+	if rs.LeaseTTL < MinLeaseTTL {
+		return fmt.Errorf("--lease-ttl: must be at least %d seconds for the keepalive to refresh in time, got %d",
+			MinLeaseTTL, rs.LeaseTTL)
+	}
+
+	//Once we are gone the entries must vanish before the dns caches expire
+	if rs.LeaseTTL > rs.TTL {
+		return fmt.Errorf("--lease-ttl: %d must not be longer than --ttl %d", rs.LeaseTTL, rs.TTL)
+	}
+
+	return nil
+}
+
+// BuildEntries - Translate the host ips into the key value to be written
+func BuildEntries(rs RecordSet, hostips []string) []Entry {
+	return BuildWeightedEntries(rs, hostips, nil)
+}
+
+// BuildWeightedEntries - Like BuildEntries, a host ip missing from the weights has the weight of the record set
+func BuildWeightedEntries(rs RecordSet, hostips []string, weights map[string]int) []Entry {
+
+	prefix := rs.Prefix()
+
+	name := rs.Name
+	if name == "" {
+		name = rs.DomainName
+	}
+
+	//Intialize an empty slices before writign the value
+	entries := make([]Entry, len(hostips))
+
+	for i := range entries {
+		entries[i].Key = fmt.Sprintf("%sx%d", prefix, i+1)
+		weight, ok := weights[hostips[i]]
+		if !ok {
+			weight = rs.Weight
+		}
+		entries[i].Val = Record{Host: hostips[i], TTL: rs.TTL, Weight: weight, Owner: rs.OwnerID, RecordSet: name}.String()
+	}
+
+	return entries
+}
+
+// ZoneDomain - Dns name of the zone below the domain name, empty when the zone is no valid dns label
+func ZoneDomain(rs RecordSet, zone string) string {
+
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, zone)
+	label = strings.Trim(label, "-")
+
+	if label == "" || len(label) > 63 {
+		return ""
+	}
+
+	return label + "." + rs.DomainName
+}
+
+// BuildZoneEntries - The host ips grouped by zone, each zone under its own name below the domain name
+// The host ips without a zone are only in the global set, they keep their weight in their zone
+func BuildZoneEntries(rs RecordSet, hostips []string, zones map[string]string, weights map[string]int) []Entry {
+
+	byZone := map[string][]string{}
+	for _, ip := range hostips {
+		if domain := ZoneDomain(rs, zones[ip]); domain != "" {
+			byZone[domain] = append(byZone[domain], ip)
+		}
+	}
+
+	domains := make([]string, 0, len(byZone))
+	for domain := range byZone {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var entries []Entry
+	for _, domain := range domains {
+		zoneRS := rs
+		zoneRS.DomainName = domain
+		if zoneRS.Name == "" {
+			//Still owned by the record set of the domain
+			zoneRS.Name = rs.DomainName
+		}
+		entries = append(entries, BuildWeightedEntries(zoneRS, byZone[domain], weights)...)
+	}
+
+	return entries
+}
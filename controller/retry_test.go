@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Verify the failed publications are retried with a doubling backoff
+func TestControllerRetryBackoff(t *testing.T) {
+
+	clk := clock.NewFakeClock(time.Now())
+
+	var attempts int32
+	c := &Controller{
+		RecordSet: RecordSet{RootKey: "skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: DefaultOwnerID},
+		Lease: &leaseTest{
+			err: errors.New("etcdserver: request timed out"),
+			startLeaseFunc: func(entries []Entry, leaseTimeInSec int) bool {
+				atomic.AddInt32(&attempts, 1)
+				return false
+			},
+		},
+		Informer: &infTest{
+			fakehostip:     []string{"1.1.1.1"},
+			fakeChan:       make(chan struct{}),
+			getDNSTestFunc: func() bool { return true },
+		},
+		Clock: clk,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(context.Background())
+	}()
+
+	for i, backoff := range []time.Duration{RetryBackoff, 2 * RetryBackoff} {
+
+		testutil.WaitFor(t, "the backoff", clk.HasWaiters)
+		if n := atomic.LoadInt32(&attempts); n != int32(i+1) {
+			t.Fatalf("Expected %d attempts before the backoff but got %d", i+1, n)
+		}
+
+		clk.Step(backoff - time.Millisecond)
+		if !clk.HasWaiters() {
+			t.Fatalf("Expected to wait %s before attempt %d", backoff, i+2)
+		}
+		clk.Step(time.Millisecond)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected to give up after the third attempt")
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("Expected 3 attempts but got %d", n)
+	}
+}
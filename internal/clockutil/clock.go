@@ -0,0 +1,39 @@
+// Package clockutil - The clock every component measures time on, a fake one in the tests
+package clockutil
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Default - Every component measures time on it unless a test injects a fake one
+var Default clock.Clock = clock.RealClock{}
+
+// OrDefault - The injected clock, the real one when none was set
+func OrDefault(clk clock.Clock) clock.Clock {
+	if clk == nil {
+		return Default
+	}
+	return clk
+}
+
+// Until - Like wait.Until, f is run again a period after it returned until stop is closed,
+// the period is measured on the clock
+func Until(clk clock.Clock, f func(), period time.Duration, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		f()
+
+		select {
+		case <-clk.After(period):
+		case <-stop:
+			return
+		}
+	}
+}
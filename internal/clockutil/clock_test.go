@@ -0,0 +1,47 @@
+package clockutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestUntil(t *testing.T) {
+
+	clk := clock.NewFakeClock(time.Now())
+	stop := make(chan struct{})
+	runs := make(chan struct{}, 10)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Until(clk, func() { runs <- struct{}{} }, time.Second, stop)
+	}()
+
+	<-runs
+
+	//Not before the period
+	testutil.WaitFor(t, "the period", clk.HasWaiters)
+	clk.Step(999 * time.Millisecond)
+	select {
+	case <-runs:
+		t.Fatal("Expected to wait for the period")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clk.Step(time.Millisecond)
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected to run again after the period")
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected to return once stopped")
+	}
+}
@@ -0,0 +1,93 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/embed"
+)
+
+// EmbeddedEtcd - Single member etcd running inside the test process on random ports
+type EmbeddedEtcd struct {
+	Client *clientv3.Client
+
+	etcd     *embed.Etcd
+	dir      string
+	stopOnce sync.Once
+}
+
+// StartEmbeddedEtcd - Start etcd in a temp data dir and connect a client to it
+func StartEmbeddedEtcd(t *testing.T) *EmbeddedEtcd {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "fotofona-etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientURL := url.URL{Scheme: "http", Host: freeLocalAddr(t)}
+	peerURL := url.URL{Scheme: "http", Host: freeLocalAddr(t)}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		os.RemoveAll(dir)
+		t.Fatal("Timed out waiting for the embedded etcd")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		e.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return &EmbeddedEtcd{Client: client, etcd: e, dir: dir}
+}
+
+// Stop - Stop the server only, the client stays to see it gone
+func (e *EmbeddedEtcd) Stop() {
+	e.stopOnce.Do(e.etcd.Close)
+}
+
+// Close - Stop etcd and remove its data
+func (e *EmbeddedEtcd) Close() {
+	e.Client.Close()
+	e.Stop()
+	os.RemoveAll(e.dir)
+}
+
+// freeLocalAddr - Port picked by the kernel, released right away for etcd to listen on
+func freeLocalAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
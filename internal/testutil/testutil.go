@@ -0,0 +1,100 @@
+// Package testutil - Helpers shared by the tests of the fotofona packages
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+)
+
+// WaitFor - Poll the condition, the lease and the controller run in their own routines
+func WaitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// AdvanceWhileWaiting - Step the fake clock whenever something waits on it, until done is closed
+// The clock only moves by the waits, so its elapsed time is what was waited for in total
+func AdvanceWhileWaiting(clk *clock.FakeClock, step time.Duration, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if clk.HasWaiters() {
+			clk.Step(step)
+			continue
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// ExpectEvents - Compare the recorded events in any order
+func ExpectEvents(t *testing.T, recorder *record.FakeRecorder, expected ...string) {
+
+	t.Helper()
+
+	got := map[string]int{}
+loop:
+	for {
+		select {
+		case e := <-recorder.Events:
+			got[e]++
+		default:
+			break loop
+		}
+	}
+
+	for _, e := range expected {
+		if got[e] == 0 {
+			t.Errorf("Expected event %q but got %v", e, got)
+			continue
+		}
+		got[e]--
+	}
+
+	for e, n := range got {
+		if n > 0 {
+			t.Errorf("Unexpected event %q", e)
+		}
+	}
+}
+
+// NewMasterNode - helper function to create node
+func NewMasterNode(nodeName string, ipaddress string, statusphase string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name: nodeName,
+			Labels: map[string]string{
+				"node-role.kubernetes.io/master": "",
+			},
+		},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{
+				v1.NodeCondition{
+					Type:   v1.NodeConditionType("Ready"),
+					Status: v1.ConditionStatus(statusphase),
+				},
+			},
+			Addresses: []v1.NodeAddress{
+				v1.NodeAddress{
+					Type:    v1.NodeAddressType("InternalIP"),
+					Address: ipaddress,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,79 @@
+// Package logging - Structured log lines of every part of fotofona, one component field per part
+package logging
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Format of the log lines, see --log-format
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Value of the component field on every log line
+const (
+	ComponentCmd        = "cmd"
+	ComponentController = "controller"
+	ComponentEtcd       = "etcd"
+	ComponentInformer   = "informer"
+	ComponentEvents     = "events"
+	ComponentWebhook    = "webhook"
+	ComponentMemory     = "memory"
+	ComponentFanOut     = "fanout"
+)
+
+// rootLogger - Replaced by Setup once the flags are parsed
+var rootLogger = zap.NewNop()
+
+// Setup - Write the log lines to stderr in the given format
+func Setup(format string) error {
+
+	l, err := New(format, zapcore.Lock(os.Stderr))
+	if err != nil {
+		return err
+	}
+
+	rootLogger = l
+	return nil
+}
+
+// New - Build the logger writing the lines in the given format
+func New(format string, out zapcore.WriteSyncer) (*zap.Logger, error) {
+
+	encCfg := zap.NewProductionEncoderConfig()
+	encCfg.TimeKey = "ts"
+	encCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	var enc zapcore.Encoder
+	switch format {
+	case FormatJSON:
+		enc = zapcore.NewJSONEncoder(encCfg)
+	case FormatText:
+		encCfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		enc = zapcore.NewConsoleEncoder(encCfg)
+	default:
+		return nil, fmt.Errorf("--log-format: must be %s or %s, got %q", FormatJSON, FormatText, format)
+	}
+
+	//The -v flag decides what is shown, the core lets everything through
+	return zap.New(zapcore.NewCore(enc, out, zapcore.DebugLevel)), nil
+}
+
+// Logger - Log lines of one part of fotofona
+func Logger(component string) *zap.Logger {
+	return rootLogger.With(zap.String("component", component))
+}
+
+// LoggerV - Debug lines of one part of fotofona, only shown from the -v level up
+func LoggerV(component string, level glog.Level) *zap.Logger {
+	if !glog.V(level) {
+		return zap.NewNop()
+	}
+	return Logger(component).With(zap.Int("v", int(level)))
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewLoggerJSON(t *testing.T) {
+
+	var buf bytes.Buffer
+	l, err := New(FormatJSON, zapcore.AddSync(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.With(zap.String("component", ComponentEtcd)).Info("Granted lease", zap.Int64("leaseID", 42), zap.String("domain", "kubemaster.local"))
+
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected a json line but got %q: %s", buf.String(), err.Error())
+	}
+
+	expected := map[string]interface{}{
+		"level":     "info",
+		"msg":       "Granted lease",
+		"component": "etcd",
+		"leaseID":   float64(42),
+		"domain":    "kubemaster.local",
+	}
+	for k, v := range expected {
+		if line[k] != v {
+			t.Errorf("Expected %s to be %v but got %v", k, v, line[k])
+		}
+	}
+}
+
+func TestNewLoggerFormat(t *testing.T) {
+
+	if _, err := New(FormatText, zapcore.AddSync(&bytes.Buffer{})); err != nil {
+		t.Errorf("Unexpected error %s", err.Error())
+	}
+
+	if _, err := New("xml", zapcore.AddSync(&bytes.Buffer{})); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,116 @@
+// Package notify - Observers of the controller keeping a history and calling webhooks
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+)
+
+// HistoryStore - Append-only history of the published host ips, kept in etcd outside of --rootpath
+// so CoreDNS never serves it, only the newest limit entries of each domain are kept
+type HistoryStore struct {
+	client *clientv3.Client
+	prefix string
+	limit  int
+}
+
+// HistoryReader - Read back the history, newest first
+type HistoryReader interface {
+	List(ctx context.Context, domain string, limit int) ([]controller.Publication, error)
+}
+
+// NewHistoryStore - Keep up to limit publications of each domain under prefix
+func NewHistoryStore(client *clientv3.Client, prefix string, limit int) *HistoryStore {
+	return &HistoryStore{
+		client: client,
+		prefix: prefix,
+		limit:  limit,
+	}
+}
+
+// historyDomainPrefix - Etcd directory holding the history of the domain, ending with a slash
+func historyDomainPrefix(prefix string, domain string) string {
+	return fmt.Sprintf("/%s/%s/", strings.Trim(prefix, "/"), domain)
+}
+
+// historyKey - Zero padded nano seconds so the keys sort by time
+func historyKey(prefix string, p controller.Publication) string {
+	return fmt.Sprintf("%s%020d", historyDomainPrefix(prefix, p.Domain), p.Time.UnixNano())
+}
+
+// Published - Observer appending every publication, the controller carries on when it fails
+func (h *HistoryStore) Published(ctx context.Context, p controller.Publication) {
+	if err := h.Append(ctx, p); err != nil {
+		logging.Logger(logging.ComponentEtcd).Error("Could not append to the history", zap.String("domain", p.Domain), zap.Error(err))
+	}
+}
+
+// Append - Write the publication and drop the oldest ones beyond the limit
+func (h *HistoryStore) Append(ctx context.Context, p controller.Publication) error {
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.client.Put(ctx, historyKey(h.prefix, p), string(b)); err != nil {
+		return err
+	}
+
+	return h.trim(ctx, p.Domain)
+}
+
+// trim - Keep the newest limit entries of the domain
+func (h *HistoryStore) trim(ctx context.Context, domain string) error {
+
+	resp, err := h.client.Get(ctx, historyDomainPrefix(h.prefix, domain), clientv3.WithPrefix(), clientv3.WithKeysOnly(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return err
+	}
+
+	excess := len(resp.Kvs) - h.limit
+	if excess <= 0 {
+		return nil
+	}
+
+	ops := make([]clientv3.Op, 0, excess)
+	for _, kv := range resp.Kvs[:excess] {
+		ops = append(ops, clientv3.OpDelete(string(kv.Key)))
+	}
+
+	_, err = h.client.Txn(ctx).Then(ops...).Commit()
+	return err
+}
+
+// List - Newest publications of the domain first, all of them when limit is 0
+func (h *HistoryStore) List(ctx context.Context, domain string, limit int) ([]controller.Publication, error) {
+
+	opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend)}
+	if limit > 0 {
+		opts = append(opts, clientv3.WithLimit(int64(limit)))
+	}
+
+	resp, err := h.client.Get(ctx, historyDomainPrefix(h.prefix, domain), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]controller.Publication, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var p controller.Publication
+		if err := json.Unmarshal(kv.Value, &p); err != nil {
+			return nil, fmt.Errorf("Could not decode %s: %s", kv.Key, err.Error())
+		}
+		history = append(history, p)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+)
+
+// Verify the history keys sort the same way as the time they were published
+func TestHistoryKey(t *testing.T) {
+
+	base := time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC)
+	times := []time.Time{base.Add(time.Hour), base, base.Add(time.Nanosecond), base.Add(-24 * time.Hour)}
+
+	keys := []string{}
+	for _, tm := range times {
+		keys = append(keys, historyKey("/fotofona-history/", controller.Publication{Time: tm, Domain: "kubemaster.local"}))
+	}
+
+	if keys[1] != "/fotofona-history/kubemaster.local/01551434400000000000" {
+		t.Errorf("Unexpected key %s", keys[1])
+	}
+
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+	expected := []string{keys[3], keys[1], keys[2], keys[0]}
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("Expected %q but got %q", expected, sorted)
+	}
+}
+
+// Verify the history is kept newest first and trimmed to the limit
+func TestEtcdHistory(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewHistoryStore(e.Client, "/fotofona-history", 3)
+
+	base := time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		p := controller.Publication{Time: base.Add(time.Duration(i) * time.Minute), Domain: "kubemaster.local", Trigger: controller.TriggerInformer}
+		if err := store.Append(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := store.List(ctx, "kubemaster.local", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 publications but got %d", len(history))
+	}
+
+	for i, p := range history {
+		expected := base.Add(time.Duration(4-i) * time.Minute)
+		if !p.Time.Equal(expected) {
+			t.Errorf("Expected publication %d at %s but got %s", i, expected, p.Time)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package notify
+
+import (
+	"expvar"
+)
+
+// webhookFailures - Number of changes which could not be delivered to a webhook
+var webhookFailures = expvar.NewInt("webhook_failures")
@@ -0,0 +1,223 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// webhookSignatureHeader - Hex HMAC-SHA256 of the body with the shared secret, prefixed with sha256=
+const webhookSignatureHeader = "X-Fotofona-Signature"
+
+// webhookQueueSize - Publications waiting to be delivered before new ones are dropped
+const webhookQueueSize = 100
+
+// WebhookPayload - Posted as json whenever a different set of host ips is published
+type WebhookPayload struct {
+	Domain    string    `json:"domain"`
+	Added     []string  `json:"added"`
+	Removed   []string  `json:"removed"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookNotifier - Observer posting the publications to the webhooks, one at a time and in order
+type WebhookNotifier struct {
+	urls    []string
+	secret  []byte
+	client  *http.Client
+	retries int
+
+	//Wait before the first retry, doubled on every following one
+	backoff time.Duration
+	clock   clock.Clock
+
+	queue chan WebhookPayload
+}
+
+// webhookStatusError - The webhook answered but did not accept the payload
+type webhookStatusError struct {
+	status int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook answered %d", e.status)
+}
+
+// NewWebhookNotifier - Post to every url, each attempt is bounded by the timeout, an empty secret sends no signature
+func NewWebhookNotifier(urls []string, secret []byte, timeout time.Duration, retries int) *WebhookNotifier {
+	return &WebhookNotifier{
+		urls:    urls,
+		secret:  secret,
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		backoff: time.Second,
+		clock:   clockutil.Default,
+		queue:   make(chan WebhookPayload, webhookQueueSize),
+	}
+}
+
+// SetClock - Wait between the retries on the clock instead of the real one
+func (w *WebhookNotifier) SetClock(clk clock.Clock) {
+	w.clock = clk
+}
+
+// Published - Queue the change, the publication is dropped when the same set is written again
+func (w *WebhookNotifier) Published(ctx context.Context, p controller.Publication) {
+
+	added, removed := diffIPs(p.Old, p.New)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	payload := WebhookPayload{
+		Domain:    p.Domain,
+		Added:     added,
+		Removed:   removed,
+		Reason:    p.Trigger,
+		Timestamp: p.Time,
+	}
+
+	select {
+	case w.queue <- payload:
+	default:
+		webhookFailures.Add(1)
+		logging.Logger(logging.ComponentWebhook).Error("Webhook queue is full, dropping the change",
+			zap.String("domain", p.Domain), zap.Strings("added", added), zap.Strings("removed", removed))
+	}
+}
+
+// Start - Deliver the queued changes until the context is done
+func (w *WebhookNotifier) Start(ctx context.Context) {
+	for {
+		select {
+		case payload := <-w.queue:
+			for _, url := range w.urls {
+				w.deliver(ctx, url, payload)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver - Post the payload, retry on network errors and when the webhook is unavailable
+func (w *WebhookNotifier) deliver(ctx context.Context, url string, payload WebhookPayload) error {
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	log := logging.Logger(logging.ComponentWebhook).With(zap.String("url", url), zap.String("domain", payload.Domain))
+
+	for attempt := 0; ; attempt++ {
+
+		err = w.post(ctx, url, body)
+		if err == nil {
+			log.Info("Webhook notified", zap.Strings("added", payload.Added), zap.Strings("removed", payload.Removed))
+			return nil
+		}
+
+		if !isRetryable(err) || attempt >= w.retries {
+			webhookFailures.Add(1)
+			log.Error("Could not notify the webhook", zap.Int("attempts", attempt+1), zap.Error(err))
+			return err
+		}
+
+		wait := w.backoff << uint(attempt)
+		log.Warn("Webhook failed, retrying", zap.Int("attempt", attempt+1), zap.Duration("wait", wait), zap.Error(err))
+
+		select {
+		case <-w.clock.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post - Single attempt, bounded by the client timeout
+func (w *WebhookNotifier) post(ctx context.Context, url string, body []byte) error {
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, signPayload(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	//Let the connection be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &webhookStatusError{status: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// isRetryable - The webhook may accept the same payload later, a rejected one never will
+func isRetryable(err error) bool {
+	if statusErr, ok := err.(*webhookStatusError); ok {
+		return statusErr.status >= 500 || statusErr.status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// signPayload - Value of the signature header, the receiver computes the same over the raw body
+func signPayload(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// diffIPs - Host ips which joined and left the set, never nil so the json holds empty lists
+func diffIPs(old []string, new []string) (added []string, removed []string) {
+
+	added, removed = []string{}, []string{}
+
+	oldSet := make(map[string]struct{}, len(old))
+	for _, ip := range old {
+		oldSet[ip] = struct{}{}
+	}
+
+	newSet := make(map[string]struct{}, len(new))
+	for _, ip := range new {
+		newSet[ip] = struct{}{}
+		if _, ok := oldSet[ip]; !ok {
+			added = append(added, ip)
+		}
+	}
+
+	for _, ip := range old {
+		if _, ok := newSet[ip]; !ok {
+			removed = append(removed, ip)
+		}
+	}
+
+	return added, removed
+}
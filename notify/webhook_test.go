@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestDiffIPs(t *testing.T) {
+
+	added, removed := diffIPs([]string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.2", "10.0.0.3"})
+	if !reflect.DeepEqual(added, []string{"10.0.0.3"}) || !reflect.DeepEqual(removed, []string{"10.0.0.1"}) {
+		t.Errorf("Unexpected added %q removed %q", added, removed)
+	}
+
+	added, removed = diffIPs(nil, nil)
+	if added == nil || removed == nil {
+		t.Error("Expected empty lists instead of nil")
+	}
+}
+
+// Verify the payload is posted once with a signature the receiver can check
+func TestWebhookDeliver(t *testing.T) {
+
+	secret := []byte("s3cr3t")
+	received := make(chan WebhookPayload, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if got := r.Header.Get(webhookSignatureHeader); got != signPayload(secret, body) {
+			t.Errorf("Unexpected signature %q", got)
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+
+		var p WebhookPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Error(err)
+		}
+		received <- p
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := NewWebhookNotifier([]string{srv.URL}, secret, time.Second, 0)
+	go w.Start(ctx)
+
+	now := time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	//The same set written again is not a change
+	w.Published(ctx, controller.Publication{Time: now, Domain: "kubemaster.local", Trigger: controller.TriggerDrift,
+		Old: []string{"10.0.0.1"}, New: []string{"10.0.0.1"}})
+	w.Published(ctx, controller.Publication{Time: now, Domain: "kubemaster.local", Trigger: controller.TriggerInformer,
+		Old: []string{"10.0.0.1"}, New: []string{"10.0.0.2"}})
+
+	expected := WebhookPayload{
+		Domain:    "kubemaster.local",
+		Added:     []string{"10.0.0.2"},
+		Removed:   []string{"10.0.0.1"},
+		Reason:    controller.TriggerInformer,
+		Timestamp: now,
+	}
+
+	select {
+	case p := <-received:
+		if !reflect.DeepEqual(p, expected) {
+			t.Errorf("Expected %+v but got %+v", expected, p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook was never called")
+	}
+
+	select {
+	case p := <-received:
+		t.Errorf("Unexpected second call %+v", p)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// Verify the unavailable webhook is retried and the rejecting one is not
+func TestWebhookRetry(t *testing.T) {
+
+	tests := []struct {
+		statuses []int
+		expected int32
+		ok       bool
+		waited   time.Duration
+	}{
+		{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, expected: 3, ok: true, waited: 3 * time.Second},
+		{statuses: []int{http.StatusBadRequest}, expected: 1, ok: false},
+		{statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, expected: 3, ok: false, waited: 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&calls, 1)
+			w.WriteHeader(tt.statuses[n-1])
+		}))
+
+		//Waits of 1s then 2s, stepped by the test
+		clk := clock.NewFakeClock(time.Now())
+		start := clk.Now()
+		done := make(chan struct{})
+		go testutil.AdvanceWhileWaiting(clk, time.Second, done)
+
+		w := NewWebhookNotifier([]string{srv.URL}, nil, time.Second, 2)
+		w.SetClock(clk)
+
+		err := w.deliver(context.Background(), srv.URL, WebhookPayload{Domain: "kubemaster.local"})
+		close(done)
+
+		if (err == nil) != tt.ok || atomic.LoadInt32(&calls) != tt.expected {
+			t.Errorf("%v: expected ok %t after %d calls but got %v after %d", tt.statuses, tt.ok, tt.expected, err, calls)
+		}
+		if waited := clk.Since(start); waited != tt.waited {
+			t.Errorf("%v: expected to back off %s but waited %s", tt.statuses, tt.waited, waited)
+		}
+
+		srv.Close()
+	}
+}
+
+// Verify a hanging webhook gives up after the timeout
+func TestWebhookTimeout(t *testing.T) {
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	w := NewWebhookNotifier([]string{srv.URL}, nil, 100*time.Millisecond, 0)
+
+	start := time.Now()
+	if err := w.deliver(context.Background(), srv.URL, WebhookPayload{Domain: "kubemaster.local"}); err == nil {
+		t.Error("Expected a timeout error")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected to give up after the timeout but took %s", elapsed)
+	}
+}
@@ -0,0 +1,194 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/tweakmy/fotofona/config"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/logging"
+	"github.com/tweakmy/fotofona/sink"
+	"github.com/tweakmy/fotofona/source"
+	"go.uber.org/zap"
+)
+
+// nodesAddressTypes - Set with --nodes-address-types
+var nodesAddressTypes []string
+
+// static - Set with the --static flags
+var static struct {
+	ips          []string
+	file         string
+	configMap    string
+	configMapKey string
+	refresh      time.Duration
+}
+
+// adoptLegacyKeys - Set with --adopt-legacy-keys
+var adoptLegacyKeys bool
+
+// NodesAddressTypes - The address types of --nodes-address-types, in order of preference
+func NodesAddressTypes() []string {
+	return nodesAddressTypes
+}
+
+func init() {
+
+	RegisterSource(Source{
+		Name: "nodes",
+		AddFlags: func(fs *pflag.FlagSet) {
+			fs.StringSliceVarP(&nodesAddressTypes, "nodes-address-types", "", []string{source.DefaultAddressType}, "node address types published in order of preference, e.g. InternalIP,ExternalIP")
+		},
+		New: func(d *Deps) (controller.InformerInf, error) {
+			addressTypes := nodesAddressTypes
+			if len(d.AddressTypes) > 0 {
+				addressTypes = d.AddressTypes
+			}
+
+			inf := source.NewInformer(d.Options.WatchLabels, d.Clientset)
+			inf.SetAddressTypes(addressTypes)
+			inf.SetZoneLabel(d.Options.ZoneLabel)
+			inf.SetWeightAnnotation(d.Options.WeightAnnotation)
+			inf.SetClock(clockutil.OrDefault(d.Clock))
+			if d.Recorder != nil {
+				inf.SetEventRecorder(d.Recorder)
+			}
+			return inf, nil
+		},
+	})
+
+	RegisterSource(Source{
+		Name: "static",
+		AddFlags: func(fs *pflag.FlagSet) {
+			fs.StringSliceVarP(&static.ips, "static-ips", "", []string{}, "comma separated host ips published by the static source")
+			fs.StringVarP(&static.file, "static-file", "", "", "file holding more host ips for the static source, separated by spaces, commas or new lines")
+			fs.StringVarP(&static.configMap, "static-configmap", "", "", "namespace/name of a ConfigMap holding more host ips for the static source")
+			fs.StringVarP(&static.configMapKey, "static-configmap-key", "", source.DefaultConfigMapKey, "key of --static-configmap holding the host ips")
+			fs.DurationVarP(&static.refresh, "static-refresh", "", source.DefaultStaticRefresh, "read --static-file and --static-configmap again every period")
+		},
+		New: func(d *Deps) (controller.InformerInf, error) {
+			if len(static.ips) == 0 && static.file == "" && static.configMap == "" {
+				return nil, errors.New("--static-ips, --static-file or --static-configmap: at least one is needed")
+			}
+
+			ips, err := source.ParseIPs(strings.Join(static.ips, ","))
+			if err != nil {
+				return nil, fmt.Errorf("--static-ips: %s", err.Error())
+			}
+
+			if static.refresh <= 0 {
+				return nil, errors.New("--static-refresh: must be positive")
+			}
+
+			st := source.NewStatic(ips)
+			st.SetRefresh(static.refresh)
+			st.SetClock(clockutil.OrDefault(d.Clock))
+
+			if static.file != "" {
+				st.SetFile(static.file)
+			}
+
+			if static.configMap != "" {
+				parts := strings.Split(static.configMap, "/")
+				if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+					return nil, fmt.Errorf("--static-configmap: %q must be namespace/name", static.configMap)
+				}
+				st.SetConfigMap(d.Clientset, parts[0], parts[1], static.configMapKey)
+			}
+
+			return st, nil
+		},
+	})
+
+	RegisterSink(Sink{
+		Name: "etcd",
+		//The history, records, purge, diff and doctor commands connect to the same etcd
+		AddPersistentFlags: func(fs *pflag.FlagSet, o *config.Options) {
+			fs.StringSliceVarP(&o.EtcdEndpoints, "endpoints", "", []string{"http://localhost:2378"}, "comma separated etcd endpoints")
+			fs.BoolVarP(&o.InsecureSkipTLSVerify, "insecure-skip-tls-verify", "", false, "skip server certificate verification for etcd")
+			fs.StringVarP(&o.CACert, "cacerts", "", "", "verify certificates of TLS-enabled secure servers using this CA bundle for etcd")
+			fs.StringVarP(&o.Cert, "cert", "", "", "identify secure client using this TLS certificate file for etcd")
+			fs.StringVarP(&o.Key, "key", "", "", "identify secure client using this TLS key file for etcd")
+		},
+		AddFlags: func(fs *pflag.FlagSet) {
+			fs.BoolVarP(&adoptLegacyKeys, "adopt-legacy-keys", "", false, "remove the xN keys of --domainname without any owner once at startup, left by hand or by a version before --owner-id; otherwise they are never touched")
+		},
+		New: func(d *Deps) (NewLease, error) {
+			cli, err := d.EtcdClient()
+			if err != nil {
+				return nil, err
+			}
+
+			if adoptLegacyKeys {
+				if err := removeLegacyKeys(d); err != nil {
+					return nil, err
+				}
+			}
+
+			if d.Options.DryRun {
+				logging.Logger(logging.ComponentCmd).Info("Dry run: nothing is written to etcd")
+				return func(ownerID string) controller.LeaseInf {
+					return sink.NewDryRunLease(cli, ownerID)
+				}, nil
+			}
+
+			return func(ownerID string) controller.LeaseInf {
+				return sink.NewEtcdLease(cli, ownerID)
+			}, nil
+		},
+	})
+
+	RegisterSink(Sink{
+		Name:  "memory",
+		Local: true,
+		New: func(d *Deps) (NewLease, error) {
+			logging.Logger(logging.ComponentCmd).Info("Memory sink: the entries are only logged")
+			store := sink.NewMemoryStore(clockutil.OrDefault(d.Clock))
+			return func(ownerID string) controller.LeaseInf {
+				return sink.NewMemoryLease(store, ownerID)
+			}, nil
+		},
+	})
+}
+
+// removeLegacyKeys - Free the slots of --domainname held by keys without any owner, only logged in a dry run
+func removeLegacyKeys(d *Deps) error {
+
+	if d.Options.CRD {
+		return errors.New("--adopt-legacy-keys: only the keys of --domainname are adopted, not the ones of --crd")
+	}
+
+	cli, err := d.EtcdClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prefix := controller.DomainPrefix(d.Options.RootPath, d.Options.DomainName)
+	legacy, err := sink.LegacyKeys(ctx, cli, prefix)
+	if err != nil {
+		return fmt.Errorf("--adopt-legacy-keys: %s", err.Error())
+	}
+
+	if d.Options.DryRun {
+		for _, kv := range legacy {
+			logging.Logger(logging.ComponentCmd).Info("Dry run: would remove the legacy key", zap.String("key", string(kv.Key)), zap.String("value", string(kv.Value)))
+		}
+		return nil
+	}
+
+	removed, err := sink.RemoveLegacyKeys(ctx, cli, legacy)
+	if err != nil {
+		return fmt.Errorf("--adopt-legacy-keys: %s", err.Error())
+	}
+
+	logging.Logger(logging.ComponentCmd).Info("Removed the legacy keys", zap.String("prefix", prefix), zap.Strings("keys", removed))
+	return nil
+}
@@ -0,0 +1,362 @@
+// Package registry - Sources and sinks selected by name with --source and --sink, each bringing its own flags
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/spf13/pflag"
+	"github.com/tweakmy/fotofona/config"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/sink"
+	"github.com/tweakmy/fotofona/source"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// NewLease - Lease of one owner, the MasterDNSRecord controller asks for one per record
+type NewLease func(ownerID string) controller.LeaseInf
+
+// Source - Where the host ips come from
+type Source struct {
+	Name string
+
+	//AddFlags - Flags of this source only, nil when it has none
+	AddFlags func(fs *pflag.FlagSet)
+
+	//New - Build the informer once the flags are parsed
+	New func(d *Deps) (controller.InformerInf, error)
+}
+
+// Sink - Where the entries are written
+type Sink struct {
+	Name string
+
+	//Local - Nothing leaves the process, there is nothing to keep a history of or to notify about
+	Local bool
+
+	//AddFlags - Flags of this sink only, nil when it has none
+	AddFlags func(fs *pflag.FlagSet)
+
+	//AddPersistentFlags - Flags of this sink the subcommands read too, nil when it has none
+	AddPersistentFlags func(fs *pflag.FlagSet, o *config.Options)
+
+	//New - Build the leases once the flags are parsed
+	New func(d *Deps) (NewLease, error)
+}
+
+// Deps - What the sources and sinks are built from, the clients are only connected when asked for
+type Deps struct {
+	Options   *config.Options
+	Clientset kubernetes.Interface
+	Recorder  record.EventRecorder
+	Clock     clock.Clock
+
+	//AddressTypes - Optional, the address types of a MasterDNSRecord in place of --nodes-address-types
+	AddressTypes []string
+
+	etcdOnce sync.Once
+	etcdCli  *clientv3.Client
+	etcdErr  error
+}
+
+// EtcdClient - Connect to etcd once, shared by every sink and the history
+func (d *Deps) EtcdClient() (*clientv3.Client, error) {
+	d.etcdOnce.Do(func() {
+		d.etcdCli, d.etcdErr = d.Options.EtcdClient()
+	})
+	return d.etcdCli, d.etcdErr
+}
+
+var (
+	mu      sync.Mutex
+	sources = map[string]Source{}
+	sinks   = map[string]Sink{}
+)
+
+// RegisterSource - Make a source selectable with --source, the name must be unique
+func RegisterSource(s Source) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := sources[s.Name]; ok {
+		panic(fmt.Sprintf("registry: source %q registered twice", s.Name))
+	}
+	sources[s.Name] = s
+}
+
+// RegisterSink - Make a sink selectable with --sink, the name must be unique
+func RegisterSink(s Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := sinks[s.Name]; ok {
+		panic(fmt.Sprintf("registry: sink %q registered twice", s.Name))
+	}
+	sinks[s.Name] = s
+}
+
+// Sources - Registered sources sorted by name
+func Sources() []Source {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := make([]Source, 0, len(sources))
+	for _, s := range sources {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Sinks - Registered sinks sorted by name
+func Sinks() []Sink {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := make([]Sink, 0, len(sinks))
+	for _, s := range sinks {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// LookupSource - Registered source of that name
+func LookupSource(name string) (Source, error) {
+	mu.Lock()
+	s, ok := sources[name]
+	mu.Unlock()
+
+	if !ok {
+		return Source{}, fmt.Errorf("--source: %q must be one of %s", name, strings.Join(sourceNames(), ", "))
+	}
+	return s, nil
+}
+
+// LookupSink - Registered sink of that name
+func LookupSink(name string) (Sink, error) {
+	mu.Lock()
+	s, ok := sinks[name]
+	mu.Unlock()
+
+	if !ok {
+		return Sink{}, fmt.Errorf("--sink: %q must be one of %s", name, strings.Join(sinkNames(), ", "))
+	}
+	return s, nil
+}
+
+// AddFlags - Add --source, --sink and the flags of every registered implementation
+func AddFlags(fs *pflag.FlagSet, o *config.Options) {
+
+	AddSourceFlags(fs, o)
+
+	fs.StringSliceVarP(&o.Sinks, "sink", "", []string{config.DefaultSink}, "comma separated sinks the entries are written to: "+strings.Join(sinkNames(), ", "))
+	fs.StringVarP(&o.SinkFailurePolicy, "sink-failure-policy", "", sink.FailurePolicyIsolate, "isolate: a failing sink is retried in the background while the others are written; block: no sink after a failing one is written")
+	fs.IntVarP(&o.SinkRetries, "sink-retries", "", sink.DefaultSinkRetries, "retries of a failing sink with a doubling backoff before the publication is given up on it")
+
+	for _, s := range Sinks() {
+		if s.AddFlags != nil {
+			s.AddFlags(fs)
+		}
+	}
+}
+
+// AddSourceFlags - Add --source, the merge, the probe and the flags of every registered source,
+// for the subcommands reading the host ips the way the controller does
+func AddSourceFlags(fs *pflag.FlagSet, o *config.Options) {
+
+	fs.StringSliceVarP(&o.Sources, "source", "", []string{config.DefaultSource}, "comma separated sources the host ips come from: "+strings.Join(sourceNames(), ", "))
+	fs.StringVarP(&o.SourceMerge, "source-merge", "", source.MergeUnion, "union: the host ips of every source; fallback: the host ips of the first source having any, in the order of --source")
+	fs.IntVarP(&o.ProbePort, "probe-port", "", 0, "only publish the host ips of every source accepting a tcp connection on this port, e.g. 6443; 0: no probe")
+	fs.DurationVarP(&o.ProbeTimeout, "probe-timeout", "", source.DefaultProbeTimeout, "timeout of every probe")
+	fs.DurationVarP(&o.ProbeInterval, "probe-interval", "", source.DefaultProbeInterval, "probe the host ips again every interval")
+
+	for _, s := range Sources() {
+		if s.AddFlags != nil {
+			s.AddFlags(fs)
+		}
+	}
+}
+
+// AddPersistentFlags - Add the flags every registered sink shares with the subcommands
+func AddPersistentFlags(fs *pflag.FlagSet, o *config.Options) {
+	for _, s := range Sinks() {
+		if s.AddPersistentFlags != nil {
+			s.AddPersistentFlags(fs, o)
+		}
+	}
+}
+
+// NewSources - Build the sources selected by name, merged with --source-merge and probed with --probe-port
+func NewSources(names []string, d *Deps) (controller.InformerInf, error) {
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("--source: at least one of %s is needed", strings.Join(sourceNames(), ", "))
+	}
+
+	if err := source.ValidateMerge(d.Options.SourceMerge); err != nil {
+		return nil, err
+	}
+
+	if d.Options.ProbePort < 0 || d.Options.ProbePort > 65535 {
+		return nil, fmt.Errorf("--probe-port: %d is not a port", d.Options.ProbePort)
+	}
+
+	seen := map[string]bool{}
+	var sources []source.HostSource
+
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("--source: %q selected twice", name)
+		}
+		seen[name] = true
+
+		s, err := LookupSource(name)
+		if err != nil {
+			return nil, err
+		}
+
+		inf, err := s.New(d)
+		if err != nil {
+			return nil, fmt.Errorf("--source %s: %s", name, err.Error())
+		}
+		sources = append(sources, inf)
+	}
+
+	var inf controller.InformerInf = sources[0]
+	if len(sources) > 1 {
+		inf = source.NewMerged(d.Options.SourceMerge, sources...)
+	}
+
+	//Probed after the merge, whatever source the host ips come from
+	if d.Options.ProbePort != 0 {
+		if d.Options.ProbeTimeout <= 0 || d.Options.ProbeInterval <= 0 {
+			return nil, fmt.Errorf("--probe-timeout and --probe-interval: must be positive")
+		}
+		prober := source.NewProber(inf, d.Options.ProbePort)
+		prober.SetTimeout(d.Options.ProbeTimeout)
+		prober.SetInterval(d.Options.ProbeInterval)
+		prober.SetClock(clockutil.OrDefault(d.Clock))
+		inf = prober
+	}
+
+	return inf, nil
+}
+
+// NewRecordSources - Build the source of every MasterDNSRecord like NewSources, with the same merge, probe and flags
+// The selector and the address types of the record take the place of --watchlabels and --nodes-address-types
+func NewRecordSources(names []string, d *Deps) (controller.NewRecordSource, error) {
+
+	//The flags are checked once up front rather than on every record
+	if _, err := NewSources(names, d); err != nil {
+		return nil, err
+	}
+
+	return func(selector string, addressTypes []string) (controller.InformerInf, error) {
+		options := *d.Options
+		options.WatchLabels = selector
+
+		return NewSources(names, &Deps{
+			Options:      &options,
+			Clientset:    d.Clientset,
+			Recorder:     d.Recorder,
+			Clock:        d.Clock,
+			AddressTypes: addressTypes,
+		})
+	}, nil
+}
+
+// SinkSet - The selected sinks, built
+type SinkSet struct {
+	//NewLease - A FanOut over the leases of every sink
+	NewLease NewLease
+
+	//Local - None of the sinks leaves the process
+	Local bool
+
+	//Health - Whether the sinks accept the entries, for the metrics and /readyz
+	Health *sink.SinkHealth
+}
+
+// NewSinks - Build the sinks selected by name, written together through a FanOut
+// with --sink-failure-policy and --sink-retries
+func NewSinks(names []string, d *Deps) (*SinkSet, error) {
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("--sink: at least one of %s is needed", strings.Join(sinkNames(), ", "))
+	}
+
+	if err := sink.ValidateFailurePolicy(d.Options.SinkFailurePolicy); err != nil {
+		return nil, err
+	}
+
+	if d.Options.SinkRetries < 0 {
+		return nil, fmt.Errorf("--sink-retries: must not be negative")
+	}
+
+	local := true
+	seen := map[string]bool{}
+	var builders []NewLease
+
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("--sink: %q selected twice", name)
+		}
+		seen[name] = true
+
+		s, err := LookupSink(name)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := s.New(d)
+		if err != nil {
+			return nil, fmt.Errorf("--sink %s: %s", name, err.Error())
+		}
+
+		builders = append(builders, b)
+		local = local && s.Local
+	}
+
+	health := sink.NewSinkHealth(d.Options.SinkFailurePolicy, names...)
+
+	newLease := func(ownerID string) controller.LeaseInf {
+		leases := make([]sink.NamedLease, len(builders))
+		for i, b := range builders {
+			leases[i] = sink.NamedLease{Name: names[i], Lease: b(ownerID)}
+		}
+
+		fanOut := sink.NewFanOut(leases...)
+		fanOut.SetPolicy(d.Options.SinkFailurePolicy)
+		fanOut.SetRetries(d.Options.SinkRetries)
+		fanOut.SetClock(clockutil.OrDefault(d.Clock))
+		fanOut.SetHealth(health)
+		return fanOut
+	}
+
+	return &SinkSet{NewLease: newLease, Local: local, Health: health}, nil
+}
+
+// sourceNames - Registered source names, sorted
+func sourceNames() []string {
+	var names []string
+	for _, s := range Sources() {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// sinkNames - Registered sink names, sorted
+func sinkNames() []string {
+	var names []string
+	for _, s := range Sinks() {
+		names = append(names, s.Name)
+	}
+	return names
+}
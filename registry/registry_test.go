@@ -0,0 +1,223 @@
+package registry
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/tweakmy/fotofona/config"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"github.com/tweakmy/fotofona/sink"
+	"github.com/tweakmy/fotofona/source"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewSinks(t *testing.T) {
+
+	d := &Deps{Options: &config.Options{SinkFailurePolicy: sink.FailurePolicyIsolate}}
+
+	set, err := NewSinks([]string{"memory"}, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !set.Local {
+		t.Error("Expected the memory sink to be local")
+	}
+
+	//A second sink fans out
+	RegisterSink(Sink{Name: "test-remote", New: func(d *Deps) (NewLease, error) {
+		store := sink.NewMemoryStore(clock.NewFakeClock(time.Now()))
+		return func(ownerID string) controller.LeaseInf {
+			return sink.NewMemoryLease(store, ownerID)
+		}, nil
+	}})
+	defer func() {
+		mu.Lock()
+		delete(sinks, "test-remote")
+		mu.Unlock()
+	}()
+
+	set, err = NewSinks([]string{"memory", "test-remote"}, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Local {
+		t.Error("Expected a remote sink not to be local")
+	}
+	if _, ok := set.NewLease("fotofona").(*sink.FanOut); !ok {
+		t.Errorf("Expected a fan out but got %T", set.NewLease("fotofona"))
+	}
+	if status := set.Health.Status(); len(status) != 2 || status[1].Name != "test-remote" {
+		t.Errorf("Expected the health of both sinks but got %+v", status)
+	}
+
+	for _, names := range [][]string{{}, {"memory", "memory"}, {"unknown"}} {
+		if _, err := NewSinks(names, d); err == nil {
+			t.Errorf("Expected %v to be rejected", names)
+		}
+	}
+
+	d.Options.SinkFailurePolicy = "ignore"
+	if _, err := NewSinks([]string{"memory"}, d); err == nil {
+		t.Error("Expected an unknown failure policy to be rejected")
+	}
+}
+
+func TestLookup(t *testing.T) {
+
+	if _, err := LookupSource("nodes"); err != nil {
+		t.Error(err)
+	}
+
+	_, err := LookupSink("rfc2136")
+	if err == nil || !strings.Contains(err.Error(), "etcd, memory") {
+		t.Errorf("Expected the registered sinks to be listed but got %v", err)
+	}
+
+	var names []string
+	for _, s := range Sinks() {
+		names = append(names, s.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"etcd", "memory"}) {
+		t.Errorf("Expected the sinks sorted by name but got %v", names)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a second nodes source to panic")
+		}
+	}()
+
+	RegisterSource(Source{Name: "nodes"})
+}
+
+// Verify the etcd flags come with the etcd sink and fill the options the subcommands connect with
+func TestAddPersistentFlags(t *testing.T) {
+
+	var opts config.Options
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddPersistentFlags(fs, &opts)
+
+	if err := fs.Parse([]string{"--endpoints", "https://etcd-0:2379,https://etcd-1:2379", "--cacerts", "/ca.pem"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(opts.EtcdEndpoints, []string{"https://etcd-0:2379", "https://etcd-1:2379"}) || opts.CACert != "/ca.pem" {
+		t.Errorf("Expected the etcd flags in the options but got %v and %q", opts.EtcdEndpoints, opts.CACert)
+	}
+}
+
+func TestNewSources(t *testing.T) {
+
+	saved := static
+	defer func() { static = saved }()
+
+	static.ips = []string{"10.0.0.1"}
+	static.refresh = time.Second
+
+	d := &Deps{Options: &config.Options{SourceMerge: source.MergeUnion}}
+
+	inf, err := NewSources([]string{"static"}, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := inf.(*source.Static); !ok {
+		t.Errorf("Expected the static source alone but got %T", inf)
+	}
+
+	//The probe wraps whatever the sources are
+	d.Options.ProbePort = 6443
+	d.Options.ProbeTimeout = time.Second
+	d.Options.ProbeInterval = time.Second
+	if inf, err := NewSources([]string{"static"}, d); err != nil {
+		t.Error(err)
+	} else if _, ok := inf.(*source.Prober); !ok {
+		t.Errorf("Expected a prober but got %T", inf)
+	}
+
+	d.Options.SourceMerge = "intersect"
+	if _, err := NewSources([]string{"static"}, d); err == nil {
+		t.Error("Expected an unknown merge to be rejected")
+	}
+
+	d.Options.SourceMerge = source.MergeFallback
+	static.ips = []string{"master-1"}
+	if _, err := NewSources([]string{"static"}, d); err == nil {
+		t.Error("Expected a host name in --static-ips to be rejected")
+	}
+
+	static.ips = nil
+	if _, err := NewSources([]string{"static"}, d); err == nil {
+		t.Error("Expected the static source without any ip to be rejected")
+	}
+}
+
+// Verify every record gets the selected sources with its own selector and address types
+func TestNewRecordSources(t *testing.T) {
+
+	saved := nodesAddressTypes
+	defer func() { nodesAddressTypes = saved }()
+	nodesAddressTypes = []string{source.DefaultAddressType}
+
+	master := testutil.NewMasterNode("master-1", "10.0.0.1", "True")
+	master.Labels = map[string]string{"pool": "api"}
+	master.Status.Addresses = append(master.Status.Addresses, v1.NodeAddress{Type: v1.NodeExternalIP, Address: "192.0.2.1"})
+	other := testutil.NewMasterNode("master-2", "10.0.0.2", "True")
+
+	d := &Deps{
+		Options:   &config.Options{WatchLabels: "node-role.kubernetes.io/master=", SourceMerge: source.MergeUnion},
+		Clientset: fake.NewSimpleClientset(master, other),
+	}
+
+	newSource, err := NewRecordSources([]string{"nodes"}, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inf, err := newSource("pool=api", []string{"ExternalIP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, ok := inf.(*source.Informer)
+	if !ok {
+		t.Fatalf("Expected the nodes source but got %T", inf)
+	}
+	if err := source.ReadOnce(context.Background(), nodes); err != nil {
+		t.Fatal(err)
+	}
+	if ips, _ := nodes.GetHostIPs(context.Background()); !reflect.DeepEqual(ips, []string{"192.0.2.1"}) {
+		t.Errorf("Expected the external ip of the selected node but got %v", ips)
+	}
+
+	if d.Options.WatchLabels != "node-role.kubernetes.io/master=" {
+		t.Errorf("Expected the flags to stay as they are but got %q", d.Options.WatchLabels)
+	}
+
+	//The probe of the flags wraps the source of every record
+	d.Options.ProbePort = 6443
+	d.Options.ProbeTimeout = time.Second
+	d.Options.ProbeInterval = time.Second
+	newSource, err = NewRecordSources([]string{"nodes"}, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inf, err := newSource("pool=api", nil); err != nil {
+		t.Error(err)
+	} else if _, ok := inf.(*source.Prober); !ok {
+		t.Errorf("Expected a prober but got %T", inf)
+	}
+
+	if _, err := NewRecordSources([]string{"unknown"}, d); err == nil {
+		t.Error("Expected an unknown source to be rejected up front")
+	}
+}
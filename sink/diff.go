@@ -0,0 +1,120 @@
+package sink
+
+import (
+	"context"
+	"sort"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/tweakmy/fotofona/controller"
+)
+
+// Actions the controller would take on a key
+const (
+	ActionAdd       = "add"
+	ActionChange    = "change"
+	ActionRemove    = "remove"
+	ActionUnchanged = "unchanged"
+	ActionConflict  = "conflict"
+)
+
+// EntryChange - What the controller would do to a key
+type EntryChange struct {
+	Action string `json:"action"`
+	Key    string `json:"key"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+
+	//MovedFrom - Slot of the entry held by another owner, the entry is written to Key instead
+	MovedFrom string `json:"movedFrom,omitempty"`
+}
+
+// ReadEntries - Read back the key values under the prefix
+func ReadEntries(ctx context.Context, cli *clientv3.Client, prefix string) ([]controller.Entry, error) {
+
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]controller.Entry, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		entries[i] = controller.Entry{Key: string(kv.Key), Val: string(kv.Value)}
+	}
+
+	return entries, nil
+}
+
+// DiffEntries - Compare the desired entries against what is published, following the owner rules of the lease
+// An entry whose slot is held by another owner is moved to the next free slot like the lease does,
+// it is only a conflict when no slot is free
+func DiffEntries(desired []controller.Entry, current []controller.Entry, ownerID string) []EntryChange {
+
+	published := make(map[string]string, len(current))
+	for _, entry := range current {
+		published[entry.Key] = entry.Val
+	}
+
+	owned := func(key string) bool {
+		val, ok := published[key]
+		return !ok || controller.IsOwnedBy([]byte(val), ownerID)
+	}
+
+	taken := takenSlots(desired)
+	wanted := make(map[string]struct{}, len(desired))
+	changes := []EntryChange{}
+
+	for _, entry := range desired {
+
+		key, movedFrom := entry.Key, ""
+		if !owned(key) {
+			key, movedFrom = "", entry.Key
+			slots, _ := freeSlots(entry.Key, taken)
+			for _, slot := range slots {
+				taken[slot] = true
+				if owned(slot) {
+					key = slot
+					break
+				}
+			}
+		}
+
+		if key == "" {
+			wanted[entry.Key] = struct{}{}
+			changes = append(changes, EntryChange{Action: ActionConflict, Key: entry.Key, Old: published[entry.Key], New: entry.Val})
+			continue
+		}
+
+		wanted[key] = struct{}{}
+		val, ok := published[key]
+
+		switch {
+		case !ok:
+			changes = append(changes, EntryChange{Action: ActionAdd, Key: key, New: entry.Val, MovedFrom: movedFrom})
+		case val != entry.Val:
+			changes = append(changes, EntryChange{Action: ActionChange, Key: key, Old: val, New: entry.Val, MovedFrom: movedFrom})
+		default:
+			changes = append(changes, EntryChange{Action: ActionUnchanged, Key: key, Old: val, New: entry.Val, MovedFrom: movedFrom})
+		}
+	}
+
+	for _, entry := range current {
+		if _, ok := wanted[entry.Key]; ok || !controller.IsOwnedBy([]byte(entry.Val), ownerID) {
+			continue
+		}
+		changes = append(changes, EntryChange{Action: ActionRemove, Key: entry.Key, Old: entry.Val})
+	}
+
+	sort.SliceStable(changes, func(a, b int) bool { return changes[a].Key < changes[b].Key })
+
+	return changes
+}
+
+// HasChanges - Anything other than unchanged keys
+func HasChanges(changes []EntryChange) bool {
+	for _, c := range changes {
+		if c.Action != ActionUnchanged {
+			return true
+		}
+	}
+	return false
+}
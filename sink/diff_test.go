@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tweakmy/fotofona/controller"
+)
+
+// Verify the diff follows the owner rules of the lease
+func TestDiffEntries(t *testing.T) {
+
+	prefix := "/skydns/local/kubemaster/"
+
+	rs := controller.RecordSet{RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: controller.DefaultOwnerID}
+
+	desired := controller.BuildEntries(rs, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"})
+	stale := controller.BuildEntries(rs, []string{"10.0.0.1", "10.0.0.9", "10.0.0.3", "10.0.0.4", "10.0.0.5"})
+
+	foreign := controller.Record{Host: "10.0.0.8", TTL: 60, Owner: "external-dns"}.String()
+
+	current := []controller.Entry{
+		desired[0], //x1 unchanged
+		stale[1],   //x2 changed
+		controller.Entry{Key: prefix + "x3", Val: foreign}, //x3 owned by someone else
+		stale[4], //x5 no longer desired
+		controller.Entry{Key: prefix + "manual", Val: foreign}, //left alone
+	}
+
+	//x3 is moved into x5, the first slot after the entries which is ours
+	expected := []EntryChange{
+		EntryChange{Action: ActionUnchanged, Key: prefix + "x1"},
+		EntryChange{Action: ActionChange, Key: prefix + "x2"},
+		EntryChange{Action: ActionAdd, Key: prefix + "x4"},
+		EntryChange{Action: ActionChange, Key: prefix + "x5", MovedFrom: prefix + "x3"},
+	}
+
+	changes := DiffEntries(desired, current, controller.DefaultOwnerID)
+
+	if len(changes) != len(expected) {
+		t.Errorf("Expected %d changes but got %v", len(expected), changes)
+		return
+	}
+
+	for i := range expected {
+		if changes[i].Action != expected[i].Action || changes[i].Key != expected[i].Key || changes[i].MovedFrom != expected[i].MovedFrom {
+			t.Errorf("test item %d expected %s %s %s but outcome %s %s %s",
+				i, expected[i].Action, expected[i].Key, expected[i].MovedFrom, changes[i].Action, changes[i].Key, changes[i].MovedFrom)
+		}
+	}
+
+	//Without a free slot the entry is left out like the lease does
+	var full []controller.Entry
+	for n := 1; n <= maxSlots; n++ {
+		full = append(full, controller.Entry{Key: fmt.Sprintf("%sx%d", prefix, n), Val: foreign})
+	}
+	conflicts := DiffEntries(desired[:1], full, controller.DefaultOwnerID)
+	if len(conflicts) != 1 || conflicts[0].Action != ActionConflict {
+		t.Errorf("Expected a conflict without a free slot but got %v", conflicts)
+	}
+
+	if !HasChanges(changes) {
+		t.Error("Expected the diff to report changes")
+	}
+
+	if HasChanges(DiffEntries(desired, desired, controller.DefaultOwnerID)) {
+		t.Error("Expected no changes when the desired entries are published")
+	}
+}
@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+)
+
+// DryRunLease - Log what the etcd lease would change, nothing is written
+type DryRunLease struct {
+	client  *clientv3.Client
+	ownerID string
+}
+
+// NewDryRunLease - Read from etcd and compare, never write
+func NewDryRunLease(client *clientv3.Client, ownerID string) *DryRunLease {
+	return &DryRunLease{
+		client:  client,
+		ownerID: ownerID,
+	}
+}
+
+// InitLease - Nothing is granted, the diff is logged once the prefix is known
+func (d *DryRunLease) InitLease(ctx context.Context, entries []controller.Entry, leaseTime int) error {
+	logging.Logger(logging.ComponentEtcd).Info("Dry run: would write the entries", zap.Int("entries", len(entries)), zap.Int("leaseTTL", leaseTime))
+	return nil
+}
+
+// RemoveStale - Log the difference between the entries and what is published
+func (d *DryRunLease) RemoveStale(ctx context.Context, prefix string, entries []controller.Entry) error {
+
+	current, err := ReadEntries(ctx, d.client, prefix)
+	if err != nil {
+		return err
+	}
+
+	changes := DiffEntries(entries, current, d.ownerID)
+	if !HasChanges(changes) {
+		logging.Logger(logging.ComponentEtcd).Info("Dry run: up to date", zap.String("prefix", prefix))
+		return nil
+	}
+
+	for _, c := range changes {
+		if c.Action == ActionUnchanged {
+			continue
+		}
+		logging.Logger(logging.ComponentEtcd).Info("Dry run: would change",
+			zap.String("action", c.Action), zap.String("key", c.Key), zap.String("old", c.Old), zap.String("new", c.New),
+			zap.String("movedFrom", c.MovedFrom))
+	}
+
+	return nil
+}
+
+// WatchDrift - Nothing is published, so nothing can drift
+func (d *DryRunLease) WatchDrift(ctx context.Context, prefix string, entries []controller.Entry) error {
+	return nil
+}
+
+// GetDriftChan - Never signals
+func (d *DryRunLease) GetDriftChan() chan struct{} {
+	return nil
+}
+
+// GetRenewalInteruptChan - Never signals, there is no lease to lose
+func (d *DryRunLease) GetRenewalInteruptChan() chan struct{} {
+	return nil
+}
+
+// RevokeLease - Nothing to revoke
+func (d *DryRunLease) RevokeLease(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,363 @@
+// Package sink - Where the host ips are published, etcd for CoreDNS to serve them or memory
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+)
+
+// EtcdLease - Managed all the etcd connection and renewal
+// A single lease is kept alive in the background and the entries are attached to it,
+// a new lease is only granted once the previous one is lost
+type EtcdLease struct {
+	leaseID           clientv3.LeaseID
+	leaseTTL          int
+	leaseLost         bool
+	renewalInterupted chan struct{}
+
+	//Guard the lease state shared with the keepalive routine
+	mu sync.Mutex
+
+	client *clientv3.Client
+
+	//ownerID - Only the keys carrying this owner are written over or removed
+	ownerID string
+
+	//Signals the controller that the published keys no longer match
+	driftChan chan struct{}
+
+	//Stop the previous drift watch before watching the new entries
+	cancelWatch context.CancelFunc
+
+	//Key of every entry written into another slot, the stale removal and the drift watch follow them
+	moved map[string]string
+}
+
+// errNotOwner - The key exists but was written by someone else
+var errNotOwner = errors.New("key is not owned by us")
+
+// errKeyChanged - The key was modified while we were writing it
+var errKeyChanged = errors.New("key changed while writing")
+
+// NewEtcdLease - Establish a new Lease for next op
+func NewEtcdLease(client *clientv3.Client, ownerID string) *EtcdLease {
+
+	return &EtcdLease{
+		client:            client,
+		ownerID:           ownerID,
+		driftChan:         make(chan struct{}, 1),
+		renewalInterupted: make(chan struct{}, 1),
+	}
+}
+
+// LeaseStatus - Meant to use for troubleshooting, seconds left on the current lease
+func (e *EtcdLease) LeaseStatus(ctx context.Context) (leaseID int64, remaining int64, err error) {
+	leaseID = int64(e.currentLease())
+	remaining, err = LeaseRemaining(ctx, e.client, clientv3.LeaseID(leaseID))
+	return
+}
+
+// LeaseRemaining - Seconds left before the lease expires, -1 once it is gone
+func LeaseRemaining(ctx context.Context, cli *clientv3.Client, leaseID clientv3.LeaseID) (int64, error) {
+	ttlresp, err := cli.TimeToLive(ctx, leaseID)
+	if err != nil {
+		return 0, err
+	}
+	return ttlresp.TTL, nil
+}
+
+// InitLease - Attach the entries to the lease, the lease is only granted when there is none alive
+func (e *EtcdLease) InitLease(ctx context.Context, entries []controller.Entry, leaseTimeInSec int) error {
+
+	//Our own writes are not a drift, the watch is restarted once we are done
+	e.stopWatch()
+
+	previous, err := e.ensureLease(ctx, leaseTimeInSec)
+	if err != nil {
+		logging.Logger(logging.ComponentEtcd).Error("Could not setup the lease", zap.Int("leaseTTL", leaseTimeInSec), zap.Error(err))
+		return err
+	}
+
+	//The slots of the entries are never taken by a moved one
+	taken := takenSlots(entries)
+	moved := map[string]string{}
+
+	//Write a list of entries into etcd
+	for _, entry := range entries {
+
+		logging.LoggerV(logging.ComponentEtcd, 2).Debug("Writing entry", zap.String("key", entry.Key), zap.String("value", entry.Val))
+
+		//Attempt to write the key value into etcd with the lease
+		err := e.putOwned(ctx, entry)
+		if err == errNotOwner {
+			logging.Logger(logging.ComponentEtcd).Warn("Refusing to overwrite, moving to a free slot", zap.String("key", entry.Key))
+
+			var key string
+			key, err = e.putFreeSlot(ctx, entry, taken)
+			if err == nil {
+				logging.Logger(logging.ComponentEtcd).Info("Moved to a free slot", zap.String("key", entry.Key), zap.String("slot", key))
+				moved[entry.Key] = key
+				continue
+			}
+		}
+		if err != nil {
+			logging.Logger(logging.ComponentEtcd).Error("Could not write to store", zap.String("key", entry.Key), zap.Error(err))
+			return &controller.WriteError{Key: entry.Key, Err: err}
+		}
+
+	}
+
+	e.mu.Lock()
+	e.moved = moved
+	e.mu.Unlock()
+
+	//The lease time has changed and everything moved over to the new lease
+	if previous != clientv3.NoLease {
+		if _, err := e.client.Revoke(ctx, previous); err != nil {
+			logging.Logger(logging.ComponentEtcd).Error("Could not revoke the previous lease", zap.Int64("leaseID", int64(previous)), zap.Error(err))
+		}
+	}
+
+	return nil
+
+}
+
+// ensureLease - Reuse the live lease or grant a new one, return the lease being replaced if any
+func (e *EtcdLease) ensureLease(ctx context.Context, leaseTimeInSec int) (previous clientv3.LeaseID, err error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leaseID != clientv3.NoLease && !e.leaseLost {
+		if e.leaseTTL == leaseTimeInSec {
+			return clientv3.NoLease, nil
+		}
+		previous = e.leaseID
+	}
+
+	//Grant the lease with the time
+	leaseResp, err := e.client.Grant(ctx, int64(leaseTimeInSec))
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+
+	logging.Logger(logging.ComponentEtcd).Info("Granted lease", zap.Int64("leaseID", int64(leaseResp.ID)), zap.Int("leaseTTL", leaseTimeInSec))
+
+	e.leaseID = leaseResp.ID
+	e.leaseTTL = leaseTimeInSec
+	e.leaseLost = false
+
+	if err := e.renewLease(ctx, e.leaseID); err != nil {
+		e.leaseLost = true
+		return clientv3.NoLease, err
+	}
+
+	return previous, nil
+}
+
+// currentLease - Lease the entries are attached to
+func (e *EtcdLease) currentLease() clientv3.LeaseID {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leaseID
+}
+
+// LeaseID - Lease the entries are attached to, 0 when none was granted
+func (e *EtcdLease) LeaseID() int64 {
+	return int64(e.currentLease())
+}
+
+// stopWatch - Stop the drift watch on the previous entries
+func (e *EtcdLease) stopWatch() {
+	if e.cancelWatch != nil {
+		e.cancelWatch()
+		e.cancelWatch = nil
+	}
+}
+
+// putFreeSlot - Write the entry into the first slot of its prefix which is free or ours and not taken,
+// the slot is marked taken and returned
+func (e *EtcdLease) putFreeSlot(ctx context.Context, entry controller.Entry, taken map[string]bool) (string, error) {
+
+	slots, err := freeSlots(entry.Key, taken)
+	if err != nil {
+		return "", err
+	}
+
+	for _, key := range slots {
+		taken[key] = true
+
+		err := e.putOwned(ctx, controller.Entry{Key: key, Val: entry.Val})
+		if err == errNotOwner {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return key, nil
+	}
+
+	return "", errNoFreeSlot
+}
+
+// published - The entries with the keys they were written to
+func (e *EtcdLease) published(entries []controller.Entry) []controller.Entry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return movedEntries(entries, e.moved)
+}
+
+// putOwned - Write the entry only when the key is free or already ours
+func (e *EtcdLease) putOwned(ctx context.Context, entry controller.Entry) error {
+
+	resp, err := e.client.Get(ctx, entry.Key)
+	if err != nil {
+		return err
+	}
+
+	//Make sure the key stay the way we have seen it while writing
+	cmp := clientv3.Compare(clientv3.CreateRevision(entry.Key), "=", 0)
+	if len(resp.Kvs) > 0 {
+		if !controller.IsOwnedBy(resp.Kvs[0].Value, e.ownerID) {
+			return errNotOwner
+		}
+		cmp = clientv3.Compare(clientv3.ModRevision(entry.Key), "=", resp.Kvs[0].ModRevision)
+	}
+
+	txnResp, err := e.client.Txn(ctx).
+		If(cmp).
+		Then(clientv3.OpPut(entry.Key, entry.Val, clientv3.WithLease(e.currentLease()))).
+		Commit()
+	if err != nil {
+		return err
+	}
+
+	if !txnResp.Succeeded {
+		return errKeyChanged
+	}
+
+	return nil
+}
+
+// RemoveStale - Delete the keys we own under the prefix which are no longer part of the entries
+func (e *EtcdLease) RemoveStale(ctx context.Context, prefix string, entries []controller.Entry) error {
+
+	resp, err := e.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		logging.Logger(logging.ComponentEtcd).Error("Could not read the store", zap.String("prefix", prefix), zap.Error(err))
+		return err
+	}
+
+	desired := make(map[string]struct{}, len(entries))
+	for _, entry := range e.published(entries) {
+		desired[entry.Key] = struct{}{}
+	}
+
+	for _, kv := range resp.Kvs {
+
+		key := string(kv.Key)
+
+		if _, ok := desired[key]; ok || !controller.IsOwnedBy(kv.Value, e.ownerID) {
+			continue
+		}
+
+		logging.LoggerV(logging.ComponentEtcd, 2).Debug("Removing stale key", zap.String("key", key))
+
+		//Only delete when nobody has touched the key since we read it
+		_, err := e.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(clientv3.OpDelete(key)).
+			Commit()
+		if err != nil {
+			logging.Logger(logging.ComponentEtcd).Error("Could not remove stale key", zap.String("key", key), zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renewLease - Keep on renewing the lease in the background until the context is done
+// The client's KeepAlive times the renewal on the real clock, so it is not driven by an injected clock,
+// the clock driven renewal is the one of MemoryLease and is covered by TestMemoryLeaseExpiry
+func (e *EtcdLease) renewLease(ctx context.Context, leaseID clientv3.LeaseID) error {
+
+	//Keep the lease alive forever
+	kaCh, err := e.client.KeepAlive(ctx, leaseID)
+
+	if err != nil {
+		logging.Logger(logging.ComponentEtcd).Error("Could not renew lease", zap.Int64("leaseID", int64(leaseID)), zap.Error(err))
+		return err
+	}
+
+	//Run a separate goroutine to check if the renewal is interupted, otherwise indicate to parent the renewal is interupted
+	go func() {
+
+	loop:
+		for {
+
+			select {
+			case _, ok := <-kaCh:
+
+				if !ok {
+					logging.Logger(logging.ComponentEtcd).Info("Keepalive channel closed", zap.Int64("leaseID", int64(leaseID)))
+					break loop
+				}
+				logging.LoggerV(logging.ComponentEtcd, 2).Debug("Lease refreshed", zap.Int64("leaseID", int64(leaseID)))
+			case <-ctx.Done(): //If a parent context requested to be closed
+				logging.Logger(logging.ComponentEtcd).Info("Closing renewal routine", zap.Int64("leaseID", int64(leaseID)))
+				return //Terminate the go routine
+			}
+
+		}
+
+		e.mu.Lock()
+		replaced := e.leaseID != leaseID
+		if !replaced {
+			e.leaseLost = true
+		}
+		e.mu.Unlock()
+
+		//A lease we moved away from is expected to go
+		if replaced {
+			return
+		}
+
+		logging.Logger(logging.ComponentEtcd).Info("Lease lost, signaled interuption", zap.Int64("leaseID", int64(leaseID)))
+		select {
+		case e.renewalInterupted <- struct{}{}:
+		default:
+		}
+	}()
+
+	return nil
+}
+
+// GetRenewalInteruptChan - Give the caller to redirect the program flow due to interuption
+func (e *EtcdLease) GetRenewalInteruptChan() (renewalInterupted chan struct{}) {
+	return e.renewalInterupted
+}
+
+// RevokeLease - Revoke the lease, every entry attached to it is removed
+func (e *EtcdLease) RevokeLease(ctx context.Context) error {
+
+	e.mu.Lock()
+	leaseID := e.leaseID
+	e.leaseLost = true //Never attach anything to it again
+	e.mu.Unlock()
+
+	//Nothing was ever granted
+	if leaseID == clientv3.NoLease {
+		return nil
+	}
+
+	_, err := e.client.Revoke(ctx, leaseID)
+	return err
+
+}
@@ -0,0 +1,627 @@
+package sink
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+)
+
+// func TestSum(t *testing.T) {
+
+// 	if !FuncA() {
+// 		t.Error("Wrong")
+// 	}
+
+// }
+
+//Verify that ETCD lease is working
+func TestEtcdLease(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+
+	tc := struct {
+		inputCond struct {
+			leaseTime int
+			entries   []controller.Entry
+		}
+		expected []string
+	}{
+		inputCond: struct {
+			leaseTime int
+			entries   []controller.Entry
+		}{
+			entries: []controller.Entry{
+				controller.Entry{Key: "/key1", Val: "Val1"},
+				controller.Entry{Key: "/key2", Val: "Val2"},
+			},
+			leaseTime: 2,
+		},
+		expected: []string{
+			"/key1" + ":" + "Val1",
+			"/key2" + ":" + "Val2",
+		},
+	}
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+	cli := e.Client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	etcd := NewEtcdLease(cli, controller.DefaultOwnerID)
+
+	entries := tc.inputCond.entries
+
+	//The lease is renewed until its context is done
+	leaseCtx, stopRenewal := context.WithCancel(ctx)
+	defer stopRenewal()
+
+	if err := etcd.InitLease(leaseCtx, entries, tc.inputCond.leaseTime); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cli.Get(ctx, "/key", clientv3.WithPrefix())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if len(resp.Kvs) != 2 {
+		t.Error("There should be 2 keys", resp.Kvs)
+	}
+
+	for i, kv := range resp.Kvs {
+		outcome := fmt.Sprintf("%s:", kv.Key) + fmt.Sprintf("%s", kv.Value)
+		if tc.expected[i] != outcome {
+			t.Errorf("When read key, expected: %d %s but outcome: %s", i, tc.expected[i], outcome)
+		}
+	}
+
+	//Verify the lease is renewed, the time left goes up again
+	waitForRenewal(t, cli, etcd.currentLease())
+
+	//Verify the keys are removed once the renewal stops
+	stopRenewal()
+	waitForKeys(t, cli, "/key", 0)
+
+}
+
+func TestEtcdRenewLease(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+
+	tc := struct {
+		inputCond struct {
+			leaseTime int
+			entries   []controller.Entry
+		}
+		expected []string
+	}{
+		inputCond: struct {
+			leaseTime int
+			entries   []controller.Entry
+		}{
+			entries: []controller.Entry{
+				controller.Entry{Key: "/key1", Val: "Val2"},
+				controller.Entry{Key: "/key2", Val: "Val1"},
+			},
+			leaseTime: 2,
+		},
+		expected: []string{
+			"/key1" + ":" + "Val2",
+			"/key2" + ":" + "Val1",
+		},
+	}
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+	cli := e.Client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	etcd := NewEtcdLease(cli, controller.DefaultOwnerID)
+
+	entries := tc.inputCond.entries
+
+	if err := etcd.InitLease(ctx, entries, tc.inputCond.leaseTime); err != nil {
+		t.Fatal(err)
+	}
+
+	//The renewal is started along with the lease
+	interupt := etcd.GetRenewalInteruptChan()
+
+	//Verify key is still being kept while the lease is renewed
+	waitForRenewal(t, cli, etcd.currentLease())
+
+	resp, err := cli.Get(ctx, "/key", clientv3.WithPrefix())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	//verify key value
+	for i, kv := range resp.Kvs {
+		outcome := fmt.Sprintf("%s:", kv.Key) + fmt.Sprintf("%s", kv.Value)
+		if tc.expected[i] != outcome {
+			t.Errorf("When read key, expected: %d %s but outcome: %s", i, tc.expected[i], outcome)
+		}
+	}
+
+	//Verify that after the etcd server is gone, the interupt is send
+	e.Stop()
+
+	select {
+	case <-interupt:
+		return
+	case <-time.After(10 * time.Second):
+		t.Error("Did not received the interupt")
+	}
+
+}
+
+func TestEtcdRevokeLease(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+
+	tc := struct {
+		inputCond struct {
+			leaseTime int
+			entries   []controller.Entry
+		}
+		expected []string
+	}{
+		inputCond: struct {
+			leaseTime int
+			entries   []controller.Entry
+		}{
+			entries: []controller.Entry{
+				controller.Entry{Key: "/key1", Val: "Val2"},
+				controller.Entry{Key: "/key2", Val: "Val1"},
+			},
+			leaseTime: 2,
+		},
+		expected: []string{
+			"/key1" + ":" + "Val2",
+			"/key2" + ":" + "Val1",
+		},
+	}
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	etcd := NewEtcdLease(e.Client, controller.DefaultOwnerID)
+
+	entries := tc.inputCond.entries
+
+	if err := etcd.InitLease(ctx, entries, tc.inputCond.leaseTime); err != nil {
+		t.Fatal(err)
+	}
+
+	interupt := etcd.GetRenewalInteruptChan()
+
+	if err := etcd.RevokeLease(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-interupt:
+	case <-time.After(5 * time.Second):
+		t.Error("Did not received the interupt")
+	}
+
+	//Revoking took the entries along
+	waitForKeys(t, e.Client, "/key", 0)
+
+}
+
+// Verify that the lease is reused across writes and only granted again once lost
+func TestEtcdReuseLease(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+	cli := e.Client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	etcd := NewEtcdLease(cli, controller.DefaultOwnerID)
+
+	if err := etcd.InitLease(ctx, []controller.Entry{controller.Entry{Key: "/key1", Val: "Val1"}}, 5); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	first := etcd.currentLease()
+
+	if err := etcd.InitLease(ctx, []controller.Entry{controller.Entry{Key: "/key2", Val: "Val2"}}, 5); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if etcd.currentLease() != first {
+		t.Errorf("Expected lease %d to be reused but got %d", first, etcd.currentLease())
+	}
+
+	resp, err := cli.Get(ctx, "/key", clientv3.WithPrefix())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, kv := range resp.Kvs {
+		if clientv3.LeaseID(kv.Lease) != first {
+			t.Errorf("Expected key %s attached to lease %d but got %d", kv.Key, first, kv.Lease)
+		}
+	}
+
+	if err := etcd.RevokeLease(ctx); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	<-etcd.GetRenewalInteruptChan()
+
+	if err := etcd.InitLease(ctx, []controller.Entry{controller.Entry{Key: "/key1", Val: "Val1"}}, 5); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if etcd.currentLease() == first {
+		t.Error("Expected a new lease once the previous one is lost")
+	}
+
+}
+
+// Verify that only the stale keys owned by fotofona are removed
+func TestEtcdRemoveStale(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+
+	prefix := "/skydns/local/kubemaster/"
+
+	owned := controller.Record{Host: "1.1.1.1", TTL: 60, Owner: controller.DefaultOwnerID}.String()
+	stale := controller.Record{Host: "1.1.1.2", TTL: 60, Owner: controller.DefaultOwnerID}.String()
+	foreign := controller.Record{Host: "1.1.1.3", TTL: 60}.String()
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+	cli := e.Client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//Written without a lease, as if an earlier run crashed
+	cli.Put(ctx, prefix+"x2", stale)
+	cli.Put(ctx, prefix+"manual", foreign)
+
+	etcd := NewEtcdLease(cli, controller.DefaultOwnerID)
+
+	entries := []controller.Entry{
+		controller.Entry{Key: prefix + "x1", Val: owned},
+	}
+
+	if err := etcd.InitLease(ctx, entries, 5); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if err := etcd.RemoveStale(ctx, prefix, entries); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	expected := []string{
+		prefix + "manual" + ":" + foreign,
+		prefix + "x1" + ":" + owned,
+	}
+
+	if len(resp.Kvs) != len(expected) {
+		t.Errorf("There should be %d keys but got %v", len(expected), resp.Kvs)
+		return
+	}
+
+	for i, kv := range resp.Kvs {
+		outcome := fmt.Sprintf("%s:", kv.Key) + fmt.Sprintf("%s", kv.Value)
+		if expected[i] != outcome {
+			t.Errorf("When read key, expected: %d %s but outcome: %s", i, expected[i], outcome)
+		}
+	}
+
+}
+
+// Verify that keys written by another owner are never overwritten
+func TestEtcdRefuseForeignKey(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+
+	prefix := "/skydns/local/kubemaster/"
+
+	foreign := controller.Record{Host: "1.1.1.9", TTL: 60, Owner: "external-dns"}.String()
+	owned1 := controller.Record{Host: "1.1.1.1", TTL: 60, Owner: "fotofona-a"}.String()
+	owned2 := controller.Record{Host: "1.1.1.2", TTL: 60, Owner: "fotofona-a"}.String()
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+	cli := e.Client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli.Put(ctx, prefix+"x1", foreign)
+
+	etcd := NewEtcdLease(cli, "fotofona-a")
+
+	entries := []controller.Entry{
+		controller.Entry{Key: prefix + "x1", Val: owned1},
+		controller.Entry{Key: prefix + "x2", Val: owned2},
+	}
+
+	if err := etcd.InitLease(ctx, entries, 5); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	//The moved host is neither stale nor a drift
+	if err := etcd.RemoveStale(ctx, prefix, entries); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err := etcd.WatchDrift(ctx, prefix, entries); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	expected := []string{
+		prefix + "x1" + ":" + foreign,
+		prefix + "x2" + ":" + owned2,
+		prefix + "x3" + ":" + owned1,
+	}
+
+	if len(resp.Kvs) != len(expected) {
+		t.Errorf("There should be %d keys but got %v", len(expected), resp.Kvs)
+		return
+	}
+
+	for i, kv := range resp.Kvs {
+		outcome := fmt.Sprintf("%s:", kv.Key) + fmt.Sprintf("%s", kv.Value)
+		if expected[i] != outcome {
+			t.Errorf("When read key, expected: %d %s but outcome: %s", i, expected[i], outcome)
+		}
+	}
+
+	select {
+	case <-etcd.GetDriftChan():
+		t.Error("Expected the moved host not to be a drift")
+	default:
+	}
+}
+
+// Verify a host is not published when every slot is held by another owner
+func TestEtcdNoFreeSlot(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	prefix := "/skydns/local/kubemaster/"
+
+	foreign := controller.Record{Host: "1.1.1.9", TTL: 60, Owner: "external-dns"}.String()
+	owned := controller.Record{Host: "1.1.1.1", TTL: 60, Owner: "fotofona-a"}.String()
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+	cli := e.Client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for n := 1; n <= maxSlots; n++ {
+		if _, err := cli.Put(ctx, fmt.Sprintf("%sx%d", prefix, n), foreign); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	etcd := NewEtcdLease(cli, "fotofona-a")
+
+	err := etcd.InitLease(ctx, []controller.Entry{controller.Entry{Key: prefix + "x1", Val: owned}}, 5)
+	if _, ok := err.(*controller.WriteError); !ok {
+		t.Errorf("Expected a WriteError but got %v", err)
+	}
+}
+
+// Verify which changes on the domain are considered a drift
+func TestEtcdIsDrift(t *testing.T) {
+
+	owned := controller.Record{Host: "1.1.1.1", TTL: 60, Owner: controller.DefaultOwnerID}.String()
+	edited := controller.Record{Host: "1.1.1.5", TTL: 60, Owner: controller.DefaultOwnerID}.String()
+	foreign := controller.Record{Host: "1.1.1.9", TTL: 60, Owner: "external-dns"}.String()
+
+	desired := map[string]string{"/skydns/local/kubemaster/x1": owned}
+
+	testCases := []struct {
+		evType   mvccpb.Event_EventType
+		key      string
+		val      string
+		expected bool
+	}{
+		{evType: mvccpb.PUT, key: "/skydns/local/kubemaster/x1", val: owned, expected: false},
+		{evType: mvccpb.DELETE, key: "/skydns/local/kubemaster/x1", val: "", expected: true},
+		{evType: mvccpb.PUT, key: "/skydns/local/kubemaster/x1", val: edited, expected: true},
+		{evType: mvccpb.PUT, key: "/skydns/local/kubemaster/x1", val: foreign, expected: false},
+		{evType: mvccpb.PUT, key: "/skydns/local/kubemaster/x2", val: edited, expected: true},
+		{evType: mvccpb.PUT, key: "/skydns/local/kubemaster/x2", val: foreign, expected: false},
+		{evType: mvccpb.DELETE, key: "/skydns/local/kubemaster/x2", val: "", expected: false},
+	}
+
+	for i, tc := range testCases {
+		kv := &mvccpb.KeyValue{Key: []byte(tc.key), Value: []byte(tc.val)}
+		if outcome := isDrift(tc.evType, kv, desired, controller.DefaultOwnerID); outcome != tc.expected {
+			t.Errorf("test item %d expected %t but outcome %t", i, tc.expected, outcome)
+		}
+	}
+}
+
+// waitForRenewal - Poll the lease until it outlived its granted ttl, only a renewal does that
+func waitForRenewal(t *testing.T, cli *clientv3.Client, leaseID clientv3.LeaseID) {
+	t.Helper()
+
+	start := time.Now()
+	testutil.WaitFor(t, "the lease renewal", func() bool {
+		resp, err := cli.TimeToLive(context.Background(), leaseID)
+		if err != nil || resp.TTL < 0 {
+			t.Fatalf("Lease %d is gone: %v", leaseID, err)
+		}
+		return time.Since(start) > time.Duration(resp.GrantedTTL)*time.Second+500*time.Millisecond
+	})
+}
+
+// waitForKeys - Poll the prefix until it holds that many keys
+func waitForKeys(t *testing.T, cli *clientv3.Client, prefix string, count int) {
+	t.Helper()
+
+	testutil.WaitFor(t, fmt.Sprintf("%d keys under %s", count, prefix), func() bool {
+		resp, err := cli.Get(context.Background(), prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+		return err == nil && resp.Count == int64(count)
+	})
+}
+
+// startDNS - Run coredns with the Corefile of .test-dns copied into dir, reading the etcd at the endpoint
+func startDNS(t *testing.T, dir string, endpoint string) *exec.Cmd {
+
+	corefile, err := ioutil.ReadFile("../.test-dns/Corefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := strings.Replace(string(corefile), "http://localhost:2378", endpoint, 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "Corefile"), []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("coredns", "-dns.port=8053", "-conf="+filepath.Join(dir, "Corefile"))
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd
+}
+
+// Verify that the entries is what is expected by coredns every release
+// Needs the coredns and dig binaries, only run with FOTOFONA_COREDNS_TEST set
+func TestEtcdCoreDNS(t *testing.T) {
+
+	if testing.Short() || os.Getenv("FOTOFONA_COREDNS_TEST") == "" {
+		t.Skip("Runs coredns and dig, set FOTOFONA_COREDNS_TEST to run it")
+	}
+
+	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
+	flag.Set("v", "2")
+
+	//% etcdctl put /skydns/local/skydns/x1 '{"host":"1.1.1.1","ttl":60}'
+	//% etcdctl put /skydns/local/skydns/x2 '{"host":"1.1.1.2","ttl":60}'
+
+	entries :=
+		[]controller.Entry{
+			controller.Entry{Key: "/skydns/local/kubemaster/x1", Val: "{\"host\":\"1.1.1.1\",\"ttl\":60}"},
+			controller.Entry{Key: "/skydns/local/kubemaster/x2", Val: "{\"host\":\"1.1.1.2\",\"ttl\":60}"},
+		}
+
+	expectedOutcome := `1.1.1.2
+1.1.1.1
+`
+	expectedOutcome2 := `1.1.1.1
+1.1.1.2
+`
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+	cli := e.Client
+
+	dir, err := ioutil.TempDir("", "fotofona-coredns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//Start the CoreDNS reading the embedded etcd
+	cmd := startDNS(t, dir, cli.Endpoints()[0])
+	defer cmd.Process.Kill()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	etcd := NewEtcdLease(cli, controller.DefaultOwnerID)
+	if err := etcd.InitLease(ctx, entries, 300); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	//CoreDNS answers once it has read the entries
+	var cmdlineOut string
+	testutil.WaitFor(t, "coredns to answer", func() bool {
+		out, err := exec.Command("dig", "-p", "8053", "@127.0.0.1", "kubemaster.local", "+short").Output()
+		cmdlineOut = string(out)
+		return err == nil && (cmdlineOut == expectedOutcome || cmdlineOut == expectedOutcome2)
+	})
+
+}
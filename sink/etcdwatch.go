@@ -0,0 +1,102 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+)
+
+// WatchDrift - Watch the prefix and signal when the published keys stop matching the entries
+// Calling it again replaces the previous watch
+func (e *EtcdLease) WatchDrift(ctx context.Context, prefix string, entries []controller.Entry) error {
+
+	e.stopWatch()
+
+	ctx, e.cancelWatch = context.WithCancel(ctx)
+
+	desired := make(map[string]string, len(entries))
+	for _, entry := range e.published(entries) {
+		desired[entry.Key] = entry.Val
+	}
+
+	//Catch whatever changed between the write and the watch
+	resp, err := e.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		logging.Logger(logging.ComponentEtcd).Error("Could not read the store", zap.String("prefix", prefix), zap.Error(err))
+		return err
+	}
+
+	found := 0
+	for _, kv := range resp.Kvs {
+		if isDrift(mvccpb.PUT, kv, desired, e.ownerID) {
+			e.signalDrift()
+			return nil
+		}
+		if _, ok := desired[string(kv.Key)]; ok {
+			found++
+		}
+	}
+
+	//An entry whose slot is held by another owner is looked for in the slot it was moved to
+	if found < len(desired) {
+		logging.Logger(logging.ComponentEtcd).Info("Drift detected, keys are missing", zap.Int("published", found), zap.Int("desired", len(desired)))
+		e.signalDrift()
+		return nil
+	}
+
+	watchChan := e.client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+
+	go func() {
+		for watchResp := range watchChan {
+			for _, ev := range watchResp.Events {
+				if isDrift(ev.Type, ev.Kv, desired, e.ownerID) {
+					logging.Logger(logging.ComponentEtcd).Info("Drift detected", zap.ByteString("key", ev.Kv.Key))
+					e.signalDrift()
+					return
+				}
+			}
+		}
+		logging.LoggerV(logging.ComponentEtcd, 2).Debug("Stop watching", zap.String("prefix", prefix))
+	}()
+
+	return nil
+}
+
+// signalDrift - Notify the controller without blocking, one pending signal is enough
+func (e *EtcdLease) signalDrift() {
+	select {
+	case e.driftChan <- struct{}{}:
+	default:
+	}
+}
+
+// GetDriftChan - Give the caller to reconcile when the published keys drifted
+func (e *EtcdLease) GetDriftChan() chan struct{} {
+	return e.driftChan
+}
+
+// isDrift - Decide if the change on the key moved the store away from the desired entries
+func isDrift(evType mvccpb.Event_EventType, kv *mvccpb.KeyValue, desired map[string]string, ownerID string) bool {
+
+	val, isDesired := desired[string(kv.Key)]
+
+	switch {
+	case isDesired && evType == mvccpb.DELETE:
+		//Someone removed what we published
+		return true
+	case isDesired && string(kv.Value) != val:
+		//Modified, unless another owner holds the key which we refuse to overwrite anyway
+		return controller.IsOwnedBy(kv.Value, ownerID)
+	case !isDesired && evType == mvccpb.PUT && controller.IsOwnedBy(kv.Value, ownerID):
+		//Carrying our owner marker but we never asked for it
+		return true
+	case !isDesired && evType == mvccpb.PUT:
+		logging.Logger(logging.ComponentEtcd).Warn("Foreign key showed up under the domain", zap.ByteString("key", kv.Key))
+	}
+
+	return false
+}
@@ -0,0 +1,373 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Whether a failing sink holds back the others, see --sink-failure-policy
+const (
+	//FailurePolicyIsolate - The healthy sinks are written right away, the failing ones are retried in the background
+	FailurePolicyIsolate = "isolate"
+
+	//FailurePolicyBlock - The sinks are written in order, none after a failing one until it is written
+	FailurePolicyBlock = "block"
+)
+
+// DefaultSinkRetries - Retries of a failing sink before the publication is given up on it
+const DefaultSinkRetries = 3
+
+// NamedLease - Lease of one sink, the name is used in the logs, the metrics and the readiness
+type NamedLease struct {
+	Name  string
+	Lease controller.LeaseInf
+}
+
+// fanOutSink - A sink of the fan out and its background retry
+type fanOutSink struct {
+	NamedLease
+
+	//Held while the lease is called, the controller and the retry never call it together
+	mu sync.Mutex
+
+	//The last InitLease succeeded, only then the stale keys are removed and the drift watched
+	ok bool
+
+	//Closed to give up the retry of the previous entries
+	stop chan struct{}
+}
+
+// FanOut - Publish the same entries through several leases, the controller sees them as one
+// A drift or a lost lease on any of them makes the controller publish to all of them again
+type FanOut struct {
+	sinks []*fanOutSink
+
+	policy  string
+	retries int
+	clock   clock.Clock
+	health  *SinkHealth
+
+	//Prefix of the last RemoveStale, a recovered sink catches up with it
+	mu     sync.Mutex
+	prefix string
+
+	driftChan         chan struct{}
+	renewalInterupted chan struct{}
+
+	//Forward the signals of the leases once the controller context is known
+	forward sync.Once
+}
+
+// NewFanOut - Combine the leases, in the order they are written to
+func NewFanOut(leases ...NamedLease) *FanOut {
+
+	sinks := make([]*fanOutSink, len(leases))
+	for i, l := range leases {
+		sinks[i] = &fanOutSink{NamedLease: l}
+	}
+
+	return &FanOut{
+		sinks:             sinks,
+		policy:            FailurePolicyIsolate,
+		retries:           DefaultSinkRetries,
+		clock:             clockutil.Default,
+		driftChan:         make(chan struct{}, 1),
+		renewalInterupted: make(chan struct{}, 1),
+	}
+}
+
+// SetPolicy - FailurePolicyIsolate or FailurePolicyBlock, before the first InitLease
+func (f *FanOut) SetPolicy(policy string) {
+	f.policy = policy
+}
+
+// SetRetries - Retries of a failing sink, before the first InitLease
+func (f *FanOut) SetRetries(retries int) {
+	f.retries = retries
+}
+
+// SetClock - Time the retries on the clock instead of the real one, before the first InitLease
+func (f *FanOut) SetClock(clk clock.Clock) {
+	f.clock = clk
+}
+
+// SetHealth - Report the outcome of every write, before the first InitLease
+func (f *FanOut) SetHealth(health *SinkHealth) {
+	f.health = health
+}
+
+// ValidateFailurePolicy - One of the known policies
+func ValidateFailurePolicy(policy string) error {
+	if policy != FailurePolicyIsolate && policy != FailurePolicyBlock {
+		return fmt.Errorf("--sink-failure-policy: %q must be %s or %s", policy, FailurePolicyIsolate, FailurePolicyBlock)
+	}
+	return nil
+}
+
+// InitLease - Write to the sinks according to the policy, the error is the one of the sink so a WriteError stays one
+// With the isolate policy only a failure of every sink is returned, the others are retried in the background
+// With the block policy a failing sink is retried in place and its error returned once it gives up
+func (f *FanOut) InitLease(ctx context.Context, entries []controller.Entry, leaseTime int) error {
+
+	f.forward.Do(func() {
+		for _, s := range f.sinks {
+			go forwardSignal(ctx, s.Lease.GetDriftChan(), f.driftChan)
+			go forwardSignal(ctx, s.Lease.GetRenewalInteruptChan(), f.renewalInterupted)
+		}
+	})
+
+	//The previous entries are outdated, whatever retries them can stop
+	for _, s := range f.sinks {
+		s.cancelRetry()
+	}
+
+	if f.policy == FailurePolicyBlock {
+		for _, s := range f.sinks {
+			if err := f.initWithRetries(ctx, s, entries, leaseTime); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var failed []*fanOutSink
+	var first error
+	for _, s := range f.sinks {
+		s.mu.Lock()
+		err := f.init(ctx, s, entries, leaseTime)
+		s.mu.Unlock()
+
+		if err != nil {
+			failed = append(failed, s)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	//Nothing was published, the controller retries all of them
+	if len(failed) == len(f.sinks) {
+		return first
+	}
+
+	for _, s := range failed {
+		s.stop = make(chan struct{})
+		go f.retryInBackground(ctx, s, entries, leaseTime, s.stop)
+	}
+
+	return nil
+}
+
+// RemoveStale - Remove the stale keys from every sink holding the entries
+func (f *FanOut) RemoveStale(ctx context.Context, prefix string, entries []controller.Entry) error {
+
+	f.mu.Lock()
+	f.prefix = prefix
+	f.mu.Unlock()
+
+	return f.eachWritten(func(l controller.LeaseInf) error {
+		return l.RemoveStale(ctx, prefix, entries)
+	})
+}
+
+// WatchDrift - Watch every sink holding the entries
+func (f *FanOut) WatchDrift(ctx context.Context, prefix string, entries []controller.Entry) error {
+	return f.eachWritten(func(l controller.LeaseInf) error {
+		return l.WatchDrift(ctx, prefix, entries)
+	})
+}
+
+// GetDriftChan - Signals when any of the leases drifted
+func (f *FanOut) GetDriftChan() chan struct{} {
+	return f.driftChan
+}
+
+// GetRenewalInteruptChan - Signals when any of the leases was lost
+func (f *FanOut) GetRenewalInteruptChan() chan struct{} {
+	return f.renewalInterupted
+}
+
+// RevokeLease - Stop the retries and revoke every lease
+func (f *FanOut) RevokeLease(ctx context.Context) error {
+
+	if f.health != nil {
+		defer f.health.forget(f)
+	}
+
+	var first error
+	for _, s := range f.sinks {
+		s.cancelRetry()
+
+		s.mu.Lock()
+		err := s.Lease.RevokeLease(ctx)
+		s.ok = false
+		s.mu.Unlock()
+
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// Close - Stop the retries and forget the failures once the controller stopped, the leases are left to expire
+func (f *FanOut) Close() {
+
+	for _, s := range f.sinks {
+		s.cancelRetry()
+	}
+
+	if f.health != nil {
+		f.health.forget(f)
+	}
+}
+
+// init - Write the entries to the sink and record the outcome, with the lock of the sink held
+func (f *FanOut) init(ctx context.Context, s *fanOutSink, entries []controller.Entry, leaseTime int) error {
+
+	err := s.Lease.InitLease(ctx, entries, leaseTime)
+	s.ok = err == nil
+
+	if err != nil {
+		logging.Logger(logging.ComponentFanOut).Error("Could not write to the sink", zap.String("sink", s.Name), zap.Error(err))
+	}
+	if f.health != nil {
+		f.health.record(s.Name, f, err)
+	}
+
+	return err
+}
+
+// initWithRetries - Write the entries to the sink, retried with a doubling backoff before giving up
+func (f *FanOut) initWithRetries(ctx context.Context, s *fanOutSink, entries []controller.Entry, leaseTime int) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := f.init(ctx, s, entries, leaseTime)
+	for retry := 0; err != nil && retry < f.retries; retry++ {
+		select {
+		case <-f.clock.After(controller.RetryBackoff << uint(retry)):
+		case <-ctx.Done():
+			return err
+		}
+		err = f.init(ctx, s, entries, leaseTime)
+	}
+
+	return err
+}
+
+// retryInBackground - Retry the failed sink with a doubling backoff until it catches up with the others,
+// stop is closed as soon as newer entries are published
+func (f *FanOut) retryInBackground(ctx context.Context, s *fanOutSink, entries []controller.Entry, leaseTime int, stop chan struct{}) {
+
+	log := logging.Logger(logging.ComponentFanOut).With(zap.String("sink", s.Name))
+
+	for retry := 0; retry < f.retries; retry++ {
+		select {
+		case <-f.clock.After(controller.RetryBackoff << uint(retry)):
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		if done := f.catchUp(ctx, s, entries, leaseTime, stop); done {
+			return
+		}
+	}
+
+	log.Warn("Giving up on the sink until the next publication", zap.Int("retries", f.retries))
+}
+
+// catchUp - Write the entries, remove the stale keys and watch the drift like the controller did on the others
+func (f *FanOut) catchUp(ctx context.Context, s *fanOutSink, entries []controller.Entry, leaseTime int, stop chan struct{}) (done bool) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//Checked with the lock held, newer entries are written right after us
+	select {
+	case <-stop:
+		return true
+	default:
+	}
+
+	if err := f.init(ctx, s, entries, leaseTime); err != nil {
+		return false
+	}
+
+	f.mu.Lock()
+	prefix := f.prefix
+	f.mu.Unlock()
+
+	if prefix == "" {
+		return true
+	}
+
+	if err := s.Lease.RemoveStale(ctx, prefix, entries); err != nil {
+		logging.Logger(logging.ComponentFanOut).Error("Could not remove the stale keys", zap.String("sink", s.Name), zap.Error(err))
+	}
+	if err := s.Lease.WatchDrift(ctx, prefix, entries); err != nil {
+		logging.Logger(logging.ComponentFanOut).Error("Could not watch the published keys", zap.String("sink", s.Name), zap.Error(err))
+	}
+
+	logging.Logger(logging.ComponentFanOut).Info("Sink caught up", zap.String("sink", s.Name))
+	return true
+}
+
+// eachWritten - Call fn on every sink holding the entries, a failing one does not stop the others
+func (f *FanOut) eachWritten(fn func(l controller.LeaseInf) error) error {
+
+	var first error
+	for _, s := range f.sinks {
+		s.mu.Lock()
+		var err error
+		if s.ok {
+			err = fn(s.Lease)
+		}
+		s.mu.Unlock()
+
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// cancelRetry - Stop retrying the previous entries
+func (s *fanOutSink) cancelRetry() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// forwardSignal - Pass the signals on without blocking until the context is done, nil never signals
+func forwardSignal(ctx context.Context, from chan struct{}, to chan struct{}) {
+
+	if from == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-from:
+			select {
+			case to <- struct{}{}:
+			default:
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// failingLease - A memory lease failing the next writes
+type failingLease struct {
+	*MemoryLease
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (l *failingLease) InitLease(ctx context.Context, entries []controller.Entry, leaseTime int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failures != 0 {
+		l.failures--
+		return errors.New("etcdserver: request timed out")
+	}
+	return l.MemoryLease.InitLease(ctx, entries, leaseTime)
+}
+
+var fanOutEntries = []controller.Entry{{Key: "/skydns/local/kubemaster/x1", Val: `{"host":"10.0.0.1","owner":"fotofona"}`}}
+
+const fanOutPrefix = "/skydns/local/kubemaster/"
+
+// Verify every lease is written and a drift of any of them reaches the controller
+func TestFanOut(t *testing.T) {
+
+	clk := clock.NewFakeClock(time.Now())
+	first := NewMemoryStore(clk)
+	second := NewMemoryStore(clk)
+
+	fanOut := NewFanOut(
+		NamedLease{Name: "first", Lease: NewMemoryLease(first, controller.DefaultOwnerID)},
+		NamedLease{Name: "second", Lease: NewMemoryLease(second, controller.DefaultOwnerID)},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := fanOut.InitLease(ctx, fanOutEntries, 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := fanOut.WatchDrift(ctx, fanOutPrefix, fanOutEntries); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, store := range []*MemoryStore{first, second} {
+		if _, ok := store.Get(fanOutEntries[0].Key); !ok {
+			t.Errorf("Expected the entry in store %d", i)
+		}
+	}
+
+	second.Delete(fanOutEntries[0].Key)
+
+	select {
+	case <-fanOut.GetDriftChan():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the drift of the second lease to be forwarded")
+	}
+
+	if err := fanOut.RevokeLease(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := first.Get(fanOutEntries[0].Key); ok {
+		t.Error("Expected the revoke to remove the entry")
+	}
+}
+
+// Verify a failing sink does not hold back the others and catches up in the background
+func TestFanOutIsolate(t *testing.T) {
+
+	clk := clock.NewFakeClock(time.Now())
+	healthy := NewMemoryStore(clk)
+	flaky := NewMemoryStore(clk)
+
+	health := NewSinkHealth(FailurePolicyIsolate, "healthy", "flaky")
+	fanOut := NewFanOut(
+		NamedLease{Name: "healthy", Lease: NewMemoryLease(healthy, controller.DefaultOwnerID)},
+		NamedLease{Name: "flaky", Lease: &failingLease{MemoryLease: NewMemoryLease(flaky, controller.DefaultOwnerID), failures: 1}},
+	)
+	fanOut.SetClock(clk)
+	fanOut.SetHealth(health)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := fanOut.InitLease(ctx, fanOutEntries, 30); err != nil {
+		t.Fatalf("Expected the healthy sink to be enough but got %v", err)
+	}
+	if err := fanOut.RemoveStale(ctx, fanOutPrefix, fanOutEntries); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := healthy.Get(fanOutEntries[0].Key); !ok {
+		t.Error("Expected the healthy sink to be written right away")
+	}
+	if status := health.Status(); status[0].Healthy != true || status[1].Healthy != false || status[1].Error == "" {
+		t.Errorf("Expected only the flaky sink to be unhealthy but got %+v", status)
+	}
+	if !health.Ready() {
+		t.Error("Expected to be ready with one healthy sink")
+	}
+
+	//The renewal of the healthy lease waits on the clock too
+	testutil.WaitFor(t, "the retry", func() bool {
+		clk.Step(controller.RetryBackoff)
+		_, ok := flaky.Get(fanOutEntries[0].Key)
+		return ok
+	})
+
+	testutil.WaitFor(t, "the flaky sink to be healthy", func() bool {
+		return health.Status()[1].Healthy
+	})
+}
+
+// Verify closing stops the retries and forgets the failures but leaves the entries to expire
+func TestFanOutClose(t *testing.T) {
+
+	clk := clock.NewFakeClock(time.Now())
+	healthy := NewMemoryStore(clk)
+	flaky := NewMemoryStore(clk)
+
+	health := NewSinkHealth(FailurePolicyIsolate, "healthy", "flaky")
+	fanOut := NewFanOut(
+		NamedLease{Name: "healthy", Lease: NewMemoryLease(healthy, controller.DefaultOwnerID)},
+		NamedLease{Name: "flaky", Lease: &failingLease{MemoryLease: NewMemoryLease(flaky, controller.DefaultOwnerID), failures: 100}},
+	)
+	fanOut.SetClock(clk)
+	fanOut.SetHealth(health)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := fanOut.InitLease(ctx, fanOutEntries, 30); err != nil {
+		t.Fatalf("Expected the healthy sink to be enough but got %v", err)
+	}
+	if health.Status()[1].Healthy {
+		t.Fatal("Expected the flaky sink to be unhealthy")
+	}
+
+	fanOut.Close()
+
+	if status := health.Status(); !status[0].Healthy || !status[1].Healthy {
+		t.Errorf("Expected the failures of the closed fan out to be forgotten but got %+v", status)
+	}
+	if _, ok := healthy.Get(fanOutEntries[0].Key); !ok {
+		t.Error("Expected the entries to be left to expire")
+	}
+
+	//Closing twice, like the controller and the teardown do
+	fanOut.Close()
+}
+
+// Verify the block policy retries the failing sink in place and writes nothing after it when it gives up
+func TestFanOutBlock(t *testing.T) {
+
+	clk := clock.NewFakeClock(time.Now())
+	blocking := NewMemoryStore(clk)
+	blocked := NewMemoryStore(clk)
+
+	health := NewSinkHealth(FailurePolicyBlock, "blocking", "blocked")
+	flaky := &failingLease{MemoryLease: NewMemoryLease(blocking, controller.DefaultOwnerID), failures: 3}
+	fanOut := NewFanOut(
+		NamedLease{Name: "blocking", Lease: flaky},
+		NamedLease{Name: "blocked", Lease: NewMemoryLease(blocked, controller.DefaultOwnerID)},
+	)
+	fanOut.SetPolicy(FailurePolicyBlock)
+	fanOut.SetRetries(1)
+	fanOut.SetClock(clk)
+	fanOut.SetHealth(health)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- fanOut.InitLease(ctx, fanOutEntries, 30)
+	}()
+
+	testutil.WaitFor(t, "the retry", clk.HasWaiters)
+	clk.Step(controller.RetryBackoff)
+
+	if err := <-done; err == nil {
+		t.Fatal("Expected the failing sink to fail the publication")
+	}
+	if _, ok := blocked.Get(fanOutEntries[0].Key); ok {
+		t.Error("Expected nothing to be written after the failing sink")
+	}
+	if health.Ready() {
+		t.Error("Expected not to be ready with a failing sink")
+	}
+
+	//Once it recovers within the retries everything is written
+	fanOut.SetRetries(3)
+	go func() {
+		done <- fanOut.InitLease(ctx, fanOutEntries, 30)
+	}()
+
+	testutil.WaitFor(t, "the retry", clk.HasWaiters)
+	clk.Step(controller.RetryBackoff)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []*MemoryStore{blocking, blocked} {
+		if _, ok := store.Get(fanOutEntries[0].Key); !ok {
+			t.Error("Expected the entry in every sink")
+		}
+	}
+	if !health.Ready() {
+		t.Errorf("Expected to be ready again but got %+v", health.Status())
+	}
+}
@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"expvar"
+	"sync"
+)
+
+// SinkStatus - Health of one sink as served by /readyz
+type SinkStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SinkHealth - Whether the sinks accept the entries, shared by the fan outs of every record set
+// A sink is unhealthy as long as the last write of any record set to it failed
+type SinkHealth struct {
+	mu     sync.Mutex
+	policy string
+	names  []string
+
+	//Last error of every fan out still failing, by sink name
+	failing map[string]map[*FanOut]error
+}
+
+// NewSinkHealth - Track the sinks, all of them healthy until a write fails
+func NewSinkHealth(policy string, names ...string) *SinkHealth {
+
+	h := &SinkHealth{
+		policy:  policy,
+		names:   names,
+		failing: make(map[string]map[*FanOut]error, len(names)),
+	}
+
+	for _, name := range names {
+		h.failing[name] = map[*FanOut]error{}
+		h.publish(name)
+	}
+
+	return h
+}
+
+// Status - Health of every sink in the order they were given
+func (h *SinkHealth) Status() []SinkStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := make([]SinkStatus, 0, len(h.names))
+	for _, name := range h.names {
+		status := SinkStatus{Name: name, Healthy: len(h.failing[name]) == 0}
+		for _, err := range h.failing[name] {
+			status.Error = err.Error()
+			break
+		}
+		list = append(list, status)
+	}
+
+	return list
+}
+
+// Ready - Every sink is healthy with the block policy, at least one with the isolate policy
+func (h *SinkHealth) Ready() bool {
+
+	healthy := 0
+	status := h.Status()
+	for _, s := range status {
+		if s.Healthy {
+			healthy++
+		}
+	}
+
+	if h.policy == FailurePolicyBlock {
+		return healthy == len(status)
+	}
+	return healthy > 0
+}
+
+// record - Remember the outcome of the last write of the fan out to the sink
+func (h *SinkHealth) record(name string, f *FanOut, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	failing, ok := h.failing[name]
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		sinkFailures.Add(name, 1)
+		failing[f] = err
+	} else {
+		delete(failing, f)
+	}
+	h.publish(name)
+}
+
+// forget - The fan out was revoked or closed, its failures no longer count
+func (h *SinkHealth) forget(f *FanOut) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, failing := range h.failing {
+		delete(failing, f)
+		h.publish(name)
+	}
+}
+
+// publish - Expose the health of the sink in the metrics, with the lock held
+func (h *SinkHealth) publish(name string) {
+	healthy := new(expvar.Int)
+	if len(h.failing[name]) == 0 {
+		healthy.Set(1)
+	}
+	sinkHealthy.Set(name, healthy)
+}
@@ -0,0 +1,72 @@
+package sink
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+)
+
+// LegacyKeys - The xN keys right under the prefix holding a record without any owner,
+// written by hand or by a version before the owner marker
+func LegacyKeys(ctx context.Context, cli *clientv3.Client, prefix string) ([]*mvccpb.KeyValue, error) {
+
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	var legacy []*mvccpb.KeyValue
+	for _, kv := range resp.Kvs {
+		if !isSlot(strings.TrimPrefix(string(kv.Key), prefix)) {
+			continue
+		}
+
+		r, err := controller.DecodeRecord(kv.Value)
+		if err != nil || r.Owner != "" || r.Host == "" {
+			continue
+		}
+		legacy = append(legacy, kv)
+	}
+
+	return legacy, nil
+}
+
+// RemoveLegacyKeys - Delete the legacy keys, their slots are free to be published again
+// A key changed since it was read is left alone, someone still writes it
+func RemoveLegacyKeys(ctx context.Context, cli *clientv3.Client, legacy []*mvccpb.KeyValue) ([]string, error) {
+
+	removed := []string{}
+	for _, kv := range legacy {
+
+		resp, err := cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)).
+			Then(clientv3.OpDelete(string(kv.Key))).
+			Commit()
+		if err != nil {
+			return removed, err
+		}
+
+		if !resp.Succeeded {
+			logging.Logger(logging.ComponentEtcd).Info("Legacy key changed since it was read, leaving it alone", zap.String("key", string(kv.Key)))
+			continue
+		}
+		removed = append(removed, string(kv.Key))
+	}
+
+	return removed, nil
+}
+
+// isSlot - The name is an xN slot
+func isSlot(name string) bool {
+	if !strings.HasPrefix(name, "x") {
+		return false
+	}
+	n, err := strconv.Atoi(name[1:])
+	return err == nil && n > 0
+}
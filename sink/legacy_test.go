@@ -0,0 +1,80 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+)
+
+// Verify only the owner-less xN keys are removed and their slots are published in place again
+func TestEtcdRemoveLegacyKeys(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	prefix := "/skydns/local/kubemaster/"
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+	cli := e.Client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli.Put(ctx, prefix+"x1", `{"host":"1.1.1.1"}`)
+	cli.Put(ctx, prefix+"x2", `{"host":"1.1.1.2","ttl":60}`)
+	cli.Put(ctx, prefix+"x3", controller.Record{Host: "1.1.1.3", TTL: 60, Owner: "fotofona"}.String())
+	cli.Put(ctx, prefix+"x4", controller.Record{Host: "1.1.1.4", TTL: 60, Owner: "external-dns"}.String())
+	cli.Put(ctx, prefix+"api", `{"host":"1.1.1.5"}`)
+	cli.Put(ctx, prefix+"x5/sub", `{"host":"1.1.1.6"}`)
+	cli.Put(ctx, prefix+"x6", `not a json`)
+
+	legacy, err := LegacyKeys(ctx, cli, prefix)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	keys := []string{}
+	for _, kv := range legacy {
+		keys = append(keys, string(kv.Key))
+	}
+	if fmt.Sprint(keys) != fmt.Sprint([]string{prefix + "x1", prefix + "x2"}) {
+		t.Fatalf("Expected x1 and x2 to be legacy but got %v", keys)
+	}
+
+	//Written again since it was read, someone still owns it
+	cli.Put(ctx, prefix+"x2", `{"host":"1.1.1.2","ttl":30}`)
+
+	removed, err := RemoveLegacyKeys(ctx, cli, legacy)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(removed) != fmt.Sprint([]string{prefix + "x1"}) {
+		t.Errorf("Expected only x1 to be removed but got %v", removed)
+	}
+
+	entries := []controller.Entry{
+		controller.Entry{Key: prefix + "x1", Val: controller.Record{Host: "1.1.1.1", TTL: 60, Owner: "fotofona"}.String()},
+	}
+
+	etcd := NewEtcdLease(cli, "fotofona")
+	defer etcd.RevokeLease(context.Background())
+	if err := etcd.InitLease(ctx, entries, 10); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	resp, err := cli.Get(ctx, prefix+"x1")
+	if err != nil || len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != entries[0].Val {
+		t.Errorf("Expected x1 to be published in place, got %v %v", resp, err)
+	}
+
+	for _, key := range []string{"x2", "x3", "x4", "api", "x5/sub", "x6"} {
+		if resp, err := cli.Get(ctx, prefix+key); err != nil || len(resp.Kvs) != 1 {
+			t.Errorf("Expected %s to be left alone", key)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// MemoryStore - Key values and leases kept in memory, the leases expire by the clock instead of etcd
+// Shared by the MemoryLease of every owner, like a single etcd cluster would be
+type MemoryStore struct {
+	mu    sync.Mutex
+	clock clock.Clock
+
+	kvs         map[string]memoryKV
+	leases      map[int64]*memoryLeaseState
+	nextLeaseID int64
+
+	//Called with every put and delete, like an etcd watch on the whole keyspace
+	watchers    map[int]func(evType mvccpb.Event_EventType, kv *mvccpb.KeyValue)
+	nextWatcher int
+}
+
+// errLeaseExpired - The lease expired before the entry could be attached to it
+var errLeaseExpired = errors.New("lease expired")
+
+type memoryKV struct {
+	val   string
+	lease int64
+}
+
+type memoryLeaseState struct {
+	ttl    time.Duration
+	expiry time.Time
+}
+
+type memoryEvent struct {
+	evType mvccpb.Event_EventType
+	kv     *mvccpb.KeyValue
+}
+
+// NewMemoryStore - Empty store, use a fake clock to expire the leases from a test
+func NewMemoryStore(clk clock.Clock) *MemoryStore {
+	return &MemoryStore{
+		clock:    clk,
+		kvs:      map[string]memoryKV{},
+		leases:   map[int64]*memoryLeaseState{},
+		watchers: map[int]func(mvccpb.Event_EventType, *mvccpb.KeyValue){},
+	}
+}
+
+// Put - Write the key without a lease, the way another writer of the tree would
+func (s *MemoryStore) Put(key string, val string) {
+	s.put(key, val, 0)
+}
+
+// Delete - Remove the key whoever owns it
+func (s *MemoryStore) Delete(key string) {
+
+	s.mu.Lock()
+	events := s.expireLocked()
+	if _, ok := s.kvs[key]; ok {
+		delete(s.kvs, key)
+		events = append(events, memoryEvent{mvccpb.DELETE, &mvccpb.KeyValue{Key: []byte(key)}})
+	}
+	s.mu.Unlock()
+
+	s.notify(events)
+}
+
+// Get - Value of the key, false once it is gone or its lease expired
+func (s *MemoryStore) Get(key string) (string, bool) {
+
+	s.mu.Lock()
+	events := s.expireLocked()
+	kv, ok := s.kvs[key]
+	s.mu.Unlock()
+
+	s.notify(events)
+	return kv.val, ok
+}
+
+// List - Entries under the prefix sorted by key
+func (s *MemoryStore) List(prefix string) []controller.Entry {
+
+	s.mu.Lock()
+	events := s.expireLocked()
+	entries := []controller.Entry{}
+	for key, kv := range s.kvs {
+		if strings.HasPrefix(key, prefix) {
+			entries = append(entries, controller.Entry{Key: key, Val: kv.val})
+		}
+	}
+	s.mu.Unlock()
+
+	s.notify(events)
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+func (s *MemoryStore) put(key string, val string, lease int64) bool {
+
+	s.mu.Lock()
+	events := s.expireLocked()
+	if _, ok := s.leases[lease]; lease != 0 && !ok {
+		s.mu.Unlock()
+		s.notify(events)
+		return false
+	}
+	s.kvs[key] = memoryKV{val: val, lease: lease}
+	events = append(events, memoryEvent{mvccpb.PUT, &mvccpb.KeyValue{Key: []byte(key), Value: []byte(val), Lease: lease}})
+	s.mu.Unlock()
+
+	s.notify(events)
+	return true
+}
+
+func (s *MemoryStore) grant(ttl time.Duration) int64 {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextLeaseID++
+	s.leases[s.nextLeaseID] = &memoryLeaseState{ttl: ttl, expiry: s.clock.Now().Add(ttl)}
+	return s.nextLeaseID
+}
+
+// keepAlive - Push the expiry of the lease, false once it already expired
+func (s *MemoryStore) keepAlive(lease int64) bool {
+
+	s.mu.Lock()
+	events := s.expireLocked()
+	l, ok := s.leases[lease]
+	if ok {
+		l.expiry = s.clock.Now().Add(l.ttl)
+	}
+	s.mu.Unlock()
+
+	s.notify(events)
+	return ok
+}
+
+func (s *MemoryStore) alive(lease int64) bool {
+	s.mu.Lock()
+	events := s.expireLocked()
+	_, ok := s.leases[lease]
+	s.mu.Unlock()
+
+	s.notify(events)
+	return ok
+}
+
+func (s *MemoryStore) revoke(lease int64) {
+	s.mu.Lock()
+	events := s.dropLeaseLocked(lease)
+	s.mu.Unlock()
+
+	s.notify(events)
+}
+
+func (s *MemoryStore) expireLocked() []memoryEvent {
+
+	now := s.clock.Now()
+
+	var events []memoryEvent
+	for id, l := range s.leases {
+		if now.Before(l.expiry) {
+			continue
+		}
+		logging.LoggerV(logging.ComponentMemory, 2).Debug("Lease expired", zap.Int64("leaseID", id))
+		events = append(events, s.dropLeaseLocked(id)...)
+	}
+
+	return events
+}
+
+func (s *MemoryStore) dropLeaseLocked(lease int64) []memoryEvent {
+
+	delete(s.leases, lease)
+
+	var events []memoryEvent
+	for key, kv := range s.kvs {
+		if kv.lease == lease {
+			delete(s.kvs, key)
+			events = append(events, memoryEvent{mvccpb.DELETE, &mvccpb.KeyValue{Key: []byte(key)}})
+		}
+	}
+
+	return events
+}
+
+// watch - Call fn on every change until the returned func is called
+func (s *MemoryStore) watch(fn func(evType mvccpb.Event_EventType, kv *mvccpb.KeyValue)) func() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextWatcher
+	s.nextWatcher++
+	s.watchers[id] = fn
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, id)
+	}
+}
+
+// notify - Outside of the lock, the watchers may read the store
+func (s *MemoryStore) notify(events []memoryEvent) {
+
+	if len(events) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	watchers := make([]func(mvccpb.Event_EventType, *mvccpb.KeyValue), 0, len(s.watchers))
+	for _, fn := range s.watchers {
+		watchers = append(watchers, fn)
+	}
+	s.mu.Unlock()
+
+	for _, ev := range events {
+		logging.LoggerV(logging.ComponentMemory, 2).Debug("Store changed",
+			zap.String("type", ev.evType.String()), zap.ByteString("key", ev.kv.Key), zap.ByteString("value", ev.kv.Value))
+		for _, fn := range watchers {
+			fn(ev.evType, ev.kv)
+		}
+	}
+}
+
+// MemoryLease - LeaseInf on a MemoryStore, follows the ownership and drift rules of the EtcdLease
+// The lease is renewed by the clock every third of its ttl, PauseRenewal lets it expire
+type MemoryLease struct {
+	store   *MemoryStore
+	ownerID string
+
+	//Guard the lease state shared with the renewal routine
+	mu        sync.Mutex
+	leaseID   int64
+	leaseTTL  int
+	leaseLost bool
+	paused    bool
+
+	renewalInterupted chan struct{}
+	driftChan         chan struct{}
+
+	//Stop the previous drift watch before watching the new entries
+	cancelWatch func()
+
+	//Key of every entry written into another slot, the stale removal and the drift watch follow them
+	moved map[string]string
+}
+
+// NewMemoryLease - Lease of the owner on the store
+func NewMemoryLease(store *MemoryStore, ownerID string) *MemoryLease {
+	return &MemoryLease{
+		store:             store,
+		ownerID:           ownerID,
+		driftChan:         make(chan struct{}, 1),
+		renewalInterupted: make(chan struct{}, 1),
+	}
+}
+
+// LeaseID - Lease the entries are attached to, 0 when none was granted
+func (m *MemoryLease) LeaseID() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leaseID
+}
+
+// PauseRenewal - Stop or resume keeping the lease alive, like a keepalive stuck on a partition
+func (m *MemoryLease) PauseRenewal(paused bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paused = paused
+}
+
+// InitLease - Attach the entries to the lease, the lease is only granted when there is none alive
+func (m *MemoryLease) InitLease(ctx context.Context, entries []controller.Entry, leaseTimeInSec int) error {
+
+	//Our own writes are not a drift, the watch is restarted once we are done
+	m.stopWatch()
+
+	previous, leaseID := m.ensureLease(ctx, leaseTimeInSec)
+
+	//The slots of the entries are never taken by a moved one
+	taken := takenSlots(entries)
+	moved := map[string]string{}
+
+	for _, entry := range entries {
+
+		key := entry.Key
+		cur, ok := m.store.Get(key)
+		if ok && !controller.IsOwnedBy([]byte(cur), m.ownerID) {
+			logging.Logger(logging.ComponentMemory).Warn("Refusing to overwrite, moving to a free slot", zap.String("key", entry.Key))
+
+			var err error
+			key, cur, ok, err = m.freeSlot(key, taken)
+			if err != nil {
+				logging.Logger(logging.ComponentMemory).Error("Could not write to store", zap.String("key", entry.Key), zap.Error(err))
+				return &controller.WriteError{Key: entry.Key, Err: err}
+			}
+			logging.Logger(logging.ComponentMemory).Info("Moved to a free slot", zap.String("key", entry.Key), zap.String("slot", key))
+			moved[entry.Key] = key
+		}
+
+		//Nothing is published with the memory backend, the log is all there is to see
+		if !ok || cur != entry.Val {
+			logging.Logger(logging.ComponentMemory).Info("Writing entry", zap.String("key", key), zap.String("value", entry.Val))
+		}
+
+		if !m.store.put(key, entry.Val, leaseID) {
+			return &controller.WriteError{Key: entry.Key, Err: errLeaseExpired}
+		}
+	}
+
+	m.mu.Lock()
+	m.moved = moved
+	m.mu.Unlock()
+
+	//The lease time has changed and everything moved over to the new lease
+	if previous != 0 {
+		m.store.revoke(previous)
+	}
+
+	return nil
+}
+
+// freeSlot - First slot of the prefix of the key which is free or ours and not taken, with its current value
+func (m *MemoryLease) freeSlot(key string, taken map[string]bool) (slot string, cur string, ok bool, err error) {
+
+	slots, err := freeSlots(key, taken)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	for _, slot := range slots {
+		taken[slot] = true
+		if cur, ok := m.store.Get(slot); !ok || controller.IsOwnedBy([]byte(cur), m.ownerID) {
+			return slot, cur, ok, nil
+		}
+	}
+
+	return "", "", false, errNoFreeSlot
+}
+
+// published - The entries with the keys they were written to
+func (m *MemoryLease) published(entries []controller.Entry) []controller.Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return movedEntries(entries, m.moved)
+}
+
+// ensureLease - Reuse the live lease or grant a new one, return the lease being replaced if any
+func (m *MemoryLease) ensureLease(ctx context.Context, leaseTimeInSec int) (previous int64, current int64) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.leaseID != 0 && !m.leaseLost {
+		if m.leaseTTL == leaseTimeInSec {
+			return 0, m.leaseID
+		}
+		previous = m.leaseID
+	}
+
+	m.leaseID = m.store.grant(time.Duration(leaseTimeInSec) * time.Second)
+	m.leaseTTL = leaseTimeInSec
+	m.leaseLost = false
+
+	logging.Logger(logging.ComponentMemory).Info("Granted lease", zap.Int64("leaseID", m.leaseID), zap.Int("leaseTTL", leaseTimeInSec))
+
+	go m.renewLease(ctx, m.leaseID, time.Duration(leaseTimeInSec)*time.Second/3)
+
+	return previous, m.leaseID
+}
+
+// renewLease - Keep the lease alive on every tick of the clock until it expires or the context is done
+func (m *MemoryLease) renewLease(ctx context.Context, leaseID int64, interval time.Duration) {
+
+	for {
+		select {
+		case <-m.store.clock.After(interval):
+		case <-ctx.Done():
+			return
+		}
+
+		m.mu.Lock()
+		replaced := m.leaseID != leaseID
+		paused := m.paused
+		m.mu.Unlock()
+
+		//A lease we moved away from is expected to go
+		if replaced {
+			return
+		}
+
+		if paused && m.store.alive(leaseID) || !paused && m.store.keepAlive(leaseID) {
+			continue
+		}
+
+		m.mu.Lock()
+		replaced = m.leaseID != leaseID
+		if !replaced {
+			m.leaseLost = true
+		}
+		m.mu.Unlock()
+
+		if replaced {
+			return
+		}
+
+		logging.Logger(logging.ComponentMemory).Info("Lease expired, signaled interuption", zap.Int64("leaseID", leaseID))
+		select {
+		case m.renewalInterupted <- struct{}{}:
+		default:
+		}
+		return
+	}
+}
+
+// RemoveStale - Delete the keys we own under the prefix which are no longer part of the entries
+func (m *MemoryLease) RemoveStale(ctx context.Context, prefix string, entries []controller.Entry) error {
+
+	desired := make(map[string]struct{}, len(entries))
+	for _, entry := range m.published(entries) {
+		desired[entry.Key] = struct{}{}
+	}
+
+	for _, entry := range m.store.List(prefix) {
+		if _, ok := desired[entry.Key]; ok || !controller.IsOwnedBy([]byte(entry.Val), m.ownerID) {
+			continue
+		}
+		logging.Logger(logging.ComponentMemory).Info("Removing stale key", zap.String("key", entry.Key))
+		m.store.Delete(entry.Key)
+	}
+
+	return nil
+}
+
+// WatchDrift - Signal when the published keys stop matching the entries
+// Calling it again replaces the previous watch
+func (m *MemoryLease) WatchDrift(ctx context.Context, prefix string, entries []controller.Entry) error {
+
+	m.stopWatch()
+
+	desired := make(map[string]string, len(entries))
+	for _, entry := range m.published(entries) {
+		desired[entry.Key] = entry.Val
+	}
+
+	found := 0
+	for _, entry := range m.store.List(prefix) {
+		if isDrift(mvccpb.PUT, &mvccpb.KeyValue{Key: []byte(entry.Key), Value: []byte(entry.Val)}, desired, m.ownerID) {
+			m.signalDrift()
+			return nil
+		}
+		if _, ok := desired[entry.Key]; ok {
+			found++
+		}
+	}
+
+	//An entry whose slot is held by another owner is looked for in the slot it was moved to
+	if found < len(desired) {
+		logging.Logger(logging.ComponentMemory).Info("Drift detected, keys are missing", zap.Int("published", found), zap.Int("desired", len(desired)))
+		m.signalDrift()
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	var once sync.Once
+	unwatch := m.store.watch(func(evType mvccpb.Event_EventType, kv *mvccpb.KeyValue) {
+		if ctx.Err() != nil || !strings.HasPrefix(string(kv.Key), prefix) {
+			return
+		}
+		if isDrift(evType, kv, desired, m.ownerID) {
+			once.Do(func() {
+				logging.Logger(logging.ComponentMemory).Info("Drift detected", zap.ByteString("key", kv.Key))
+				m.signalDrift()
+			})
+		}
+	})
+
+	m.cancelWatch = func() {
+		cancel()
+		unwatch()
+	}
+
+	go func() {
+		<-ctx.Done()
+		unwatch()
+	}()
+
+	return nil
+}
+
+// stopWatch - Stop the drift watch on the previous entries
+func (m *MemoryLease) stopWatch() {
+	if m.cancelWatch != nil {
+		m.cancelWatch()
+		m.cancelWatch = nil
+	}
+}
+
+// signalDrift - Notify the controller without blocking, one pending signal is enough
+func (m *MemoryLease) signalDrift() {
+	select {
+	case m.driftChan <- struct{}{}:
+	default:
+	}
+}
+
+// GetDriftChan - Give the caller to reconcile when the published keys drifted
+func (m *MemoryLease) GetDriftChan() chan struct{} {
+	return m.driftChan
+}
+
+// GetRenewalInteruptChan - Give the caller to redirect the program flow due to interuption
+func (m *MemoryLease) GetRenewalInteruptChan() chan struct{} {
+	return m.renewalInterupted
+}
+
+// RevokeLease - Revoke the lease, every entry attached to it is removed
+func (m *MemoryLease) RevokeLease(ctx context.Context) error {
+
+	m.mu.Lock()
+	leaseID := m.leaseID
+	m.leaseLost = true //Never attach anything to it again
+	m.mu.Unlock()
+
+	if leaseID != 0 {
+		m.store.revoke(leaseID)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package sink
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestMemoryLeaseOwnership(t *testing.T) {
+
+	store := NewMemoryStore(clock.NewFakeClock(time.Now()))
+	store.Put("/skydns/local/kubemaster/x2", `{"host":"10.0.0.9","owner":"external-dns"}`)
+
+	lease := NewMemoryLease(store, controller.DefaultOwnerID)
+
+	entries := controller.BuildEntries(controller.RecordSet{RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: controller.DefaultOwnerID},
+		[]string{"10.0.0.1", "10.0.0.2"})
+
+	if err := lease.InitLease(context.Background(), entries, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	//The host of the foreign slot moves to the next free one
+	moved := controller.Entry{Key: "/skydns/local/kubemaster/x3", Val: entries[1].Val}
+	expected := []controller.Entry{
+		entries[0],
+		{Key: "/skydns/local/kubemaster/x2", Val: `{"host":"10.0.0.9","owner":"external-dns"}`},
+		moved,
+	}
+	if got := store.List("/skydns/local/kubemaster/"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the foreign key to stay, expected %v but got %v", expected, got)
+	}
+
+	//Only our own keys go
+	expected = expected[:2]
+	if err := lease.RemoveStale(context.Background(), "/skydns/local/kubemaster/", entries[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.List("/skydns/local/kubemaster/"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the stale key to be removed, expected %v but got %v", expected, got)
+	}
+
+	if err := lease.RevokeLease(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.List("/skydns/local/kubemaster/"); !reflect.DeepEqual(got, expected[1:]) {
+		t.Errorf("Expected only the foreign key after the revoke but got %v", got)
+	}
+}
+
+// Verify the lease is renewed by the clock and expires once the renewal stops
+func TestMemoryLeaseExpiry(t *testing.T) {
+
+	clk := clock.NewFakeClock(time.Now())
+	store := NewMemoryStore(clk)
+	lease := NewMemoryLease(store, controller.DefaultOwnerID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	entries := []controller.Entry{{Key: "/skydns/local/kubemaster/x1", Val: `{"host":"10.0.0.1","owner":"fotofona"}`}}
+	if err := lease.InitLease(ctx, entries, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	//Renewed every 10s, the lease outlives its ttl
+	for i := 0; i < 6; i++ {
+		testutil.WaitFor(t, "the renewal", clk.HasWaiters)
+		clk.Step(10 * time.Second)
+	}
+
+	if _, ok := store.Get(entries[0].Key); !ok {
+		t.Fatal("Expected the renewed lease to hold the entry")
+	}
+
+	lease.PauseRenewal(true)
+	testutil.WaitFor(t, "the renewal", clk.HasWaiters)
+	clk.Step(time.Minute)
+
+	select {
+	case <-lease.GetRenewalInteruptChan():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the expired lease to interupt the renewal")
+	}
+
+	if _, ok := store.Get(entries[0].Key); ok {
+		t.Error("Expected the entry to expire with the lease")
+	}
+
+	//A new lease is granted on the next call
+	expired := lease.LeaseID()
+	lease.PauseRenewal(false)
+	if err := lease.InitLease(ctx, entries, 30); err != nil {
+		t.Fatal(err)
+	}
+	if lease.LeaseID() == expired {
+		t.Error("Expected a new lease once the previous one expired")
+	}
+	if _, ok := store.Get(entries[0].Key); !ok {
+		t.Error("Expected the entry to be written again")
+	}
+}
+
+func TestMemoryLeaseDrift(t *testing.T) {
+
+	store := NewMemoryStore(clock.NewFakeClock(time.Now()))
+	lease := NewMemoryLease(store, controller.DefaultOwnerID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prefix := "/skydns/local/kubemaster/"
+	entries := []controller.Entry{{Key: prefix + "x1", Val: `{"host":"10.0.0.1","owner":"fotofona"}`}}
+
+	if err := lease.InitLease(ctx, entries, 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.WatchDrift(ctx, prefix, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	//Foreign keys and other prefixes are not a drift
+	store.Put(prefix+"x9", `{"host":"10.0.0.9","owner":"external-dns"}`)
+	store.Put("/skydns/local/other/x1", entries[0].Val)
+
+	select {
+	case <-lease.GetDriftChan():
+		t.Fatal("Unexpected drift")
+	default:
+	}
+
+	store.Delete(prefix + "x1")
+
+	select {
+	case <-lease.GetDriftChan():
+	default:
+		t.Fatal("Expected the deleted key to be a drift")
+	}
+}
+
+// fixedInformer - Always the same host ips, never interupts the controller
+type fixedInformer struct {
+	hostips []string
+}
+
+func (f *fixedInformer) Start(ctx context.Context) {}
+
+func (f *fixedInformer) GetHostIPs(ctx context.Context) ([]string, error) {
+	return f.hostips, nil
+}
+
+func (f *fixedInformer) GetInformerInterupt() chan struct{} {
+	return nil
+}
+
+func (f *fixedInformer) GetInformerErrorClose() chan struct{} {
+	return nil
+}
+
+// Verify the controller grants a new lease and publishes again once the lease expired
+func TestControllerMemoryLeaseExpiry(t *testing.T) {
+
+	clk := clock.NewFakeClock(time.Now())
+	store := NewMemoryStore(clk)
+	lease := NewMemoryLease(store, controller.DefaultOwnerID)
+
+	inf := &fixedInformer{hostips: []string{"1.1.1.1"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rs := controller.RecordSet{RootKey: "skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: controller.DefaultOwnerID}
+	go controller.RunController(ctx, rs, lease, inf)
+
+	key := "/skydns/local/kubemaster/x1"
+	published := func() bool {
+		_, ok := store.Get(key)
+		return ok
+	}
+
+	testutil.WaitFor(t, "the first publication", published)
+	first := lease.LeaseID()
+
+	lease.PauseRenewal(true)
+	testutil.WaitFor(t, "the renewal", clk.HasWaiters)
+	clk.Step(time.Minute)
+	lease.PauseRenewal(false)
+
+	testutil.WaitFor(t, "a new lease", func() bool { return lease.LeaseID() != first })
+	testutil.WaitFor(t, "the publication on the new lease", published)
+}
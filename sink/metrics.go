@@ -0,0 +1,11 @@
+package sink
+
+import (
+	"expvar"
+)
+
+// sinkHealthy - 1 when the sink accepts the entries, 0 while it fails, by sink name
+var sinkHealthy = expvar.NewMap("sink_healthy")
+
+// sinkFailures - Number of failed writes, retries included, by sink name
+var sinkFailures = expvar.NewMap("sink_failures")
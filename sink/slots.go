@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tweakmy/fotofona/controller"
+)
+
+// maxSlots - Highest xN slot a host is moved to when its own slot is held by another owner
+const maxSlots = 64
+
+// errNoFreeSlot - Every slot up to maxSlots is taken or held by another owner
+var errNoFreeSlot = fmt.Errorf("no free slot up to x%d, the others are held by other owners", maxSlots)
+
+// errNoSlot - The key does not end with an xN slot, there is nowhere to move it
+var errNoSlot = errors.New("key is not owned by us and has no xN slot to move from")
+
+// takenSlots - The slots of the entries, never handed out to a moved one
+func takenSlots(entries []controller.Entry) map[string]bool {
+	taken := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		taken[entry.Key] = true
+	}
+	return taken
+}
+
+// freeSlots - The slots of the prefix of the key from x1 up to maxSlots which are not taken yet,
+// the caller marks the one it tries as taken
+func freeSlots(key string, taken map[string]bool) ([]string, error) {
+
+	i := strings.LastIndex(key, "x")
+	if i < 0 {
+		return nil, errNoSlot
+	}
+	if _, err := strconv.Atoi(key[i+1:]); err != nil {
+		return nil, errNoSlot
+	}
+
+	var slots []string
+	for n := 1; n <= maxSlots; n++ {
+		if slot := fmt.Sprintf("%sx%d", key[:i], n); !taken[slot] {
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots, nil
+}
+
+// movedEntries - The entries with the keys they were written to
+func movedEntries(entries []controller.Entry, moved map[string]string) []controller.Entry {
+
+	if len(moved) == 0 {
+		return entries
+	}
+
+	written := make([]controller.Entry, len(entries))
+	for i, entry := range entries {
+		written[i] = entry
+		if key, ok := moved[entry.Key]; ok {
+			written[i].Key = key
+		}
+	}
+	return written
+}
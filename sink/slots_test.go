@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/controller"
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Verify the etcd and the memory lease move a host out of a foreign slot the same way, the way the diff predicts
+func TestSlotMoveAcrossLeases(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("Starts an embedded etcd")
+	}
+
+	prefix := "/skydns/local/kubemaster/"
+	rs := controller.RecordSet{RootKey: "/skydns", DomainName: "kubemaster.local", TTL: 60, OwnerID: controller.DefaultOwnerID}
+
+	foreign := controller.Record{Host: "10.0.0.9", TTL: 60, Owner: "external-dns"}.String()
+	stale := controller.BuildEntries(rs, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.8"})
+
+	//x2 is held by another owner, x3 is ours, x4 is ours and no longer desired
+	before := []controller.Entry{
+		{Key: prefix + "x2", Val: foreign},
+		stale[2],
+		stale[3],
+	}
+	entries := controller.BuildEntries(rs, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+
+	//What the diff predicts is published: the changed keys and the foreign one
+	var predicted []controller.Entry
+	for _, c := range DiffEntries(entries, before, controller.DefaultOwnerID) {
+		if c.Action != ActionRemove {
+			predicted = append(predicted, controller.Entry{Key: c.Key, Val: c.New})
+		}
+	}
+	predicted = append(predicted, before[0])
+	sort.Slice(predicted, func(i, j int) bool { return predicted[i].Key < predicted[j].Key })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := testutil.StartEmbeddedEtcd(t)
+	defer e.Close()
+
+	store := NewMemoryStore(clock.NewFakeClock(time.Now()))
+
+	leases := map[string]struct {
+		lease controller.LeaseInf
+		read  func() []controller.Entry
+	}{
+		"etcd": {NewEtcdLease(e.Client, controller.DefaultOwnerID), func() []controller.Entry {
+			entries, err := ReadEntries(ctx, e.Client, prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return entries
+		}},
+		"memory": {NewMemoryLease(store, controller.DefaultOwnerID), func() []controller.Entry {
+			return store.List(prefix)
+		}},
+	}
+
+	for _, entry := range before {
+		if _, err := e.Client.Put(ctx, entry.Key, entry.Val); err != nil {
+			t.Fatal(err)
+		}
+		store.Put(entry.Key, entry.Val)
+	}
+
+	for name, l := range leases {
+		if err := l.lease.InitLease(ctx, entries, 5); err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		if err := l.lease.RemoveStale(ctx, prefix, entries); err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		if err := l.lease.WatchDrift(ctx, prefix, entries); err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+
+		if got := l.read(); !reflect.DeepEqual(got, predicted) {
+			t.Errorf("%s: expected %v but got %v", name, predicted, got)
+		}
+
+		select {
+		case <-l.lease.GetDriftChan():
+			t.Errorf("%s: expected the moved host not to be a drift", name)
+		default:
+		}
+	}
+}
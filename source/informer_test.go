@@ -0,0 +1,164 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/testutil"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+// Verify the nodes are told when they join or leave the published set
+func TestInformerRecordPublished(t *testing.T) {
+
+	recorder := record.NewFakeRecorder(10)
+	inf := NewInformer("", nil)
+	inf.SetEventRecorder(recorder)
+
+	master1 := testutil.NewMasterNode("master-1", "10.0.0.1", "True")
+	master2 := testutil.NewMasterNode("master-2", "10.0.0.2", "True")
+
+	inf.recordPublished(map[string]*v1.Node{"master-1": master1})
+	testutil.ExpectEvents(t, recorder, "Normal NodePublished Node address 10.0.0.1 added to the published set")
+
+	//Same set again, nothing to tell
+	inf.recordPublished(map[string]*v1.Node{"master-1": master1})
+	testutil.ExpectEvents(t, recorder)
+
+	inf.recordPublished(map[string]*v1.Node{"master-2": master2})
+	testutil.ExpectEvents(t, recorder,
+		"Normal NodePublished Node address 10.0.0.2 added to the published set",
+		"Normal NodeUnpublished Node address 10.0.0.1 removed from the published set")
+}
+
+// Verify the address types are tried in order
+func TestInformerNodeAddress(t *testing.T) {
+
+	node := testutil.NewMasterNode("node1", "10.0.0.1", "True")
+	node.Status.Addresses = append(node.Status.Addresses, v1.NodeAddress{Type: v1.NodeExternalIP, Address: "203.0.113.1"})
+
+	inf := NewInformer("", nil)
+
+	if ip, _, _ := inf.nodeAddress(node); ip != "10.0.0.1" {
+		t.Errorf("Expected the internal ip by default but got %s", ip)
+	}
+
+	inf.SetAddressTypes([]string{"ExternalIP", "InternalIP"})
+	if ip, _, _ := inf.nodeAddress(node); ip != "203.0.113.1" {
+		t.Errorf("Expected the external ip first but got %s", ip)
+	}
+
+	node.Status.Addresses = node.Status.Addresses[:1]
+	if ip, _, _ := inf.nodeAddress(node); ip != "10.0.0.1" {
+		t.Errorf("Expected to fall back to the internal ip but got %s", ip)
+	}
+}
+
+// Verify only a weight annotation between 1 and 65535 is read
+func TestInformerNodeWeight(t *testing.T) {
+
+	node := testutil.NewMasterNode("node1", "10.0.0.1", "True")
+	node.Annotations = map[string]string{DefaultWeightAnnotation: "200"}
+
+	inf := NewInformer("", nil)
+	if _, ok := inf.nodeWeight(node); ok {
+		t.Errorf("Expected no weight without the annotation set")
+	}
+
+	inf.SetWeightAnnotation(DefaultWeightAnnotation)
+	for _, test := range []struct {
+		val      string
+		expected int
+		ok       bool
+	}{
+		{"200", 200, true},
+		{" 1 ", 1, true},
+		{"65535", 65535, true},
+		{"0", 0, false},
+		{"65536", 0, false},
+		{"heavy", 0, false},
+	} {
+		node.Annotations[DefaultWeightAnnotation] = test.val
+		if weight, ok := inf.nodeWeight(node); weight != test.expected || ok != test.ok {
+			t.Errorf("%q: expected %d %t but got %d %t", test.val, test.expected, test.ok, weight, ok)
+		}
+	}
+
+	delete(node.Annotations, DefaultWeightAnnotation)
+	if _, ok := inf.nodeWeight(node); ok {
+		t.Errorf("Expected no weight without the annotation")
+	}
+}
+
+// Verify an invalid weight annotation is warned about once per value, not on every update
+func TestInformerInvalidWeightEvents(t *testing.T) {
+
+	recorder := record.NewFakeRecorder(10)
+	inf := NewInformer("", nil)
+	inf.SetEventRecorder(recorder)
+	inf.SetWeightAnnotation(DefaultWeightAnnotation)
+
+	node := testutil.NewMasterNode("node1", "10.0.0.1", "True")
+
+	for _, val := range []string{"heavy", "heavy", "heavy", "0", "0", "200", "0"} {
+		node.Annotations = map[string]string{DefaultWeightAnnotation: val}
+		inf.nodeWeight(node)
+	}
+
+	if events := len(recorder.Events); events != 3 {
+		t.Errorf("Expected an event for heavy, 0 and 0 again after a valid weight but got %d", events)
+	}
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; !strings.HasPrefix(event, v1.EventTypeWarning+" "+ReasonInvalidWeight) {
+			t.Errorf("Unexpected event %q", event)
+		}
+	}
+}
+
+// Verify an informer gives up on its own failures only, the others keep going
+func TestInformerGivesUp(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failing := fake.NewSimpleClientset()
+	failing.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connect: connection refused")
+	})
+	broken := NewInformer("", failing)
+
+	healthy := NewInformer("", fake.NewSimpleClientset(testutil.NewMasterNode("node1", "10.0.0.1", "True")))
+
+	go broken.Start(ctx)
+	go healthy.Start(ctx)
+
+	if !healthy.WaitForSync(ctx) {
+		t.Fatal("Expected the healthy informer to sync")
+	}
+
+	select {
+	case <-broken.GetInformerErrorClose():
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the failing informer to give up")
+	}
+
+	//Closed rather than sent on, every reader sees it and nobody blocks
+	select {
+	case <-broken.GetInformerErrorClose():
+	default:
+		t.Error("Expected the error close to stay signalled")
+	}
+
+	select {
+	case <-healthy.GetInformerErrorClose():
+		t.Error("Expected the healthy informer to keep going")
+	default:
+	}
+}
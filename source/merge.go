@@ -0,0 +1,166 @@
+package source
+
+import (
+	"context"
+	"fmt"
+)
+
+// HostSource - Same as the InformerInf of the controller, what Merged and Prober wrap
+type HostSource interface {
+	Start(ctx context.Context)
+	GetHostIPs(ctx context.Context) ([]string, error)
+	GetInformerInterupt() chan struct{}
+	GetInformerErrorClose() chan struct{}
+}
+
+// zoneSource - A source telling the zone of its host ips, like the Informer with a zone label
+type zoneSource interface {
+	GetHostZones(ctx context.Context) (map[string]string, error)
+}
+
+// weightSource - A source telling the weight of its host ips, like the Informer with a weight annotation
+type weightSource interface {
+	GetHostWeights(ctx context.Context) (map[string]int, error)
+}
+
+// How the host ips of several sources are combined, see --source-merge
+const (
+	//MergeUnion - The host ips of every source, in the order of the sources
+	MergeUnion = "union"
+
+	//MergeFallback - The host ips of the first source having any, the later ones only stand in when the earlier are empty
+	MergeFallback = "fallback"
+)
+
+// ValidateMerge - One of the known ways to merge
+func ValidateMerge(merge string) error {
+	if merge != MergeUnion && merge != MergeFallback {
+		return fmt.Errorf("--source-merge: %q must be %s or %s", merge, MergeUnion, MergeFallback)
+	}
+	return nil
+}
+
+// Merged - Several sources seen as one, a change or a failure of any of them is passed on
+type Merged struct {
+	sources []HostSource
+	merge   string
+
+	updateHostIPsChan chan struct{}
+	errCloseChan      chan struct{}
+}
+
+// NewMerged - Combine the sources with MergeUnion or MergeFallback
+func NewMerged(merge string, sources ...HostSource) *Merged {
+	return &Merged{
+		sources:           sources,
+		merge:             merge,
+		updateHostIPsChan: make(chan struct{}, 1),
+		errCloseChan:      make(chan struct{}),
+	}
+}
+
+// Start - Start every source and pass their signals on until the context is done
+func (m *Merged) Start(ctx context.Context) {
+
+	for _, src := range m.sources {
+		go src.Start(ctx)
+		go m.forward(ctx, src)
+	}
+
+	<-ctx.Done()
+}
+
+// forward - Pass the changes and the failure of the source on
+func (m *Merged) forward(ctx context.Context, src HostSource) {
+	for {
+		select {
+		case <-src.GetInformerInterupt():
+			signal(m.updateHostIPsChan)
+		case <-src.GetInformerErrorClose():
+			select {
+			case m.errCloseChan <- struct{}{}:
+			case <-ctx.Done():
+			}
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GetHostIPs - The host ips of the sources merged, without duplicates
+func (m *Merged) GetHostIPs(ctx context.Context) ([]string, error) {
+
+	var ips []string
+	for _, src := range m.sources {
+		hostips, err := src.GetHostIPs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.merge == MergeFallback && len(hostips) > 0 {
+			return uniqueIPs(hostips), nil
+		}
+		ips = append(ips, hostips...)
+	}
+
+	return uniqueIPs(ips), nil
+}
+
+// GetHostZones - Zone of the host ips of every source telling them
+func (m *Merged) GetHostZones(ctx context.Context) (map[string]string, error) {
+
+	zones := map[string]string{}
+	for _, src := range m.sources {
+		zs, ok := src.(zoneSource)
+		if !ok {
+			continue
+		}
+
+		srcZones, err := zs.GetHostZones(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for ip, zone := range srcZones {
+			if _, ok := zones[ip]; !ok {
+				zones[ip] = zone
+			}
+		}
+	}
+
+	return zones, nil
+}
+
+// GetHostWeights - Weight of the host ips of every source telling them
+func (m *Merged) GetHostWeights(ctx context.Context) (map[string]int, error) {
+
+	weights := map[string]int{}
+	for _, src := range m.sources {
+		ws, ok := src.(weightSource)
+		if !ok {
+			continue
+		}
+
+		srcWeights, err := ws.GetHostWeights(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for ip, weight := range srcWeights {
+			if _, ok := weights[ip]; !ok {
+				weights[ip] = weight
+			}
+		}
+	}
+
+	return weights, nil
+}
+
+// GetInformerInterupt - Signals when any of the sources changed
+func (m *Merged) GetInformerInterupt() chan struct{} {
+	return m.updateHostIPsChan
+}
+
+// GetInformerErrorClose - Signals when any of the sources gave up
+func (m *Merged) GetInformerErrorClose() chan struct{} {
+	return m.errCloseChan
+}
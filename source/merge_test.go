@@ -0,0 +1,50 @@
+package source
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMerged(t *testing.T) {
+
+	nodes := NewStatic([]string{"10.0.0.1", "10.0.0.2"})
+	vip := NewStatic([]string{"10.0.0.2", "10.0.0.100"})
+	empty := NewStatic(nil)
+
+	for _, test := range []struct {
+		merge    string
+		sources  []HostSource
+		expected []string
+	}{
+		{MergeUnion, []HostSource{nodes, vip}, []string{"10.0.0.1", "10.0.0.2", "10.0.0.100"}},
+		{MergeFallback, []HostSource{nodes, vip}, []string{"10.0.0.1", "10.0.0.2"}},
+		{MergeFallback, []HostSource{empty, vip}, []string{"10.0.0.2", "10.0.0.100"}},
+		{MergeFallback, []HostSource{empty, empty}, []string{}},
+	} {
+		ips, err := NewMerged(test.merge, test.sources...).GetHostIPs(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ips, test.expected) {
+			t.Errorf("%s: expected %v but got %v", test.merge, test.expected, ips)
+		}
+	}
+}
+
+// Verify a change of any source reaches the controller
+func TestMergedInterupt(t *testing.T) {
+
+	nodes := NewStatic([]string{"10.0.0.1"})
+	vip := NewStatic([]string{"10.0.0.100"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	merged := NewMerged(MergeUnion, nodes, vip)
+	go merged.Start(ctx)
+
+	signal(vip.GetInformerInterupt())
+
+	<-merged.GetInformerInterupt()
+}
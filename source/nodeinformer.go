@@ -0,0 +1,630 @@
+// Package source - Where the host ips to be published come from, the ready kubernetes nodes
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+
+	v1Api "k8s.io/api/core/v1"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	runtimeApi "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// DefaultAddressType - Node address published unless other address types are set
+const DefaultAddressType = "InternalIP"
+
+// DefaultZoneLabel - Node label holding the zone, see --zone-label
+const DefaultZoneLabel = "topology.kubernetes.io/zone"
+
+// DefaultWeightAnnotation - Node annotation holding the SkyDNS weight, see --weight-annotation
+const DefaultWeightAnnotation = "fotofona.io/weight"
+
+// maxWeight - SkyDNS weight is the 16 bit SRV weight
+const maxWeight = 65535
+
+// maxWatchFailures - Consecutive list or watch failures after which the informer gives up
+const maxWatchFailures = 3
+
+// logHandledErrorsOnce - The errors handed to runtime.HandleError are logged once for the whole process
+var logHandledErrorsOnce sync.Once
+
+// logHandledErrors - Log what client-go reports, every informer counts its own failures
+func logHandledErrors() {
+	logHandledErrorsOnce.Do(func() {
+		runtime.ErrorHandlers = append(runtime.ErrorHandlers, func(err error) {
+			logging.Logger(logging.ComponentInformer).Warn("Kubernetes client error", zap.Error(err))
+		})
+	})
+}
+
+// Reasons of the Normal events emitted on the nodes
+const (
+	ReasonNodePublished   = "NodePublished"
+	ReasonNodeUnpublished = "NodeUnpublished"
+)
+
+// ReasonInvalidWeight - Reason of the Warning event emitted on a node whose weight annotation is ignored
+const ReasonInvalidWeight = "InvalidWeight"
+
+// Informer - Kubernetes Operator to
+type Informer struct {
+
+	//kubernetes client settings
+	clientset kubernetes.Interface
+
+	//Signals the downstream api to update hostips
+	updateHostIPsChan chan struct{}
+
+	//List of the master host ips to be written
+	hostsIPs []string
+
+	//Zone of the host ips whose node carries the zone label
+	hostZones map[string]string
+
+	//Node label holding the zone, empty when the zones are not published
+	zoneLabel string
+
+	//Weight of the host ips whose node carries a valid weight annotation
+	hostWeights map[string]int
+
+	//Node annotation holding the weight, empty when the weights are not read
+	weightAnnotation string
+
+	//Last ignored weight annotation by node name, warned about once per value, only touched by the worker
+	invalidWeights map[string]string
+
+	//RW Lock in case, external issues a read
+	rwLock sync.RWMutex
+
+	//lister
+	lister v1.NodeLister
+
+	//workqueue
+	queue workqueue.RateLimitingInterface
+
+	indexer cache.Indexer
+
+	//Consecutive list and watch failures, only touched by the reflector of this informer
+	errorCount int
+
+	//Closing Down Channel due to comms error, closed once
+	errCloseChan chan struct{}
+	errCloseOnce sync.Once
+
+	//WatchLabels - comma separated label a=x,b=y
+	watchLabels string
+
+	//Closed once the initial listing is available
+	synced chan struct{}
+
+	//Optional, tell the nodes when they join or leave the published set
+	recorder record.EventRecorder
+
+	//Ready nodes currently in the published set by node name
+	published map[string]*v1Api.Node
+
+	//Node address types in order of preference
+	addressTypes []string
+
+	//Restarts the workers, the real clock when nil
+	clock clock.Clock
+}
+
+// NewInformer - Create a new Informer
+func NewInformer(watchLabels string, clientset kubernetes.Interface) *Informer {
+	return &Informer{
+		//Initialize the channel
+		updateHostIPsChan: make(chan struct{}),
+		queue:             workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		errCloseChan:      make(chan struct{}),
+		watchLabels:       watchLabels,
+		clientset:         clientset,
+		synced:            make(chan struct{}),
+		invalidWeights:    map[string]string{},
+		addressTypes:      []string{DefaultAddressType},
+		clock:             clockutil.Default,
+	}
+}
+
+// SetClock - Measure time on the clock instead of the real one, before the informer is started
+func (i *Informer) SetClock(clk clock.Clock) {
+	i.clock = clk
+}
+
+// SetEventRecorder - Emit an event on the node whenever it is added to or removed from the published set
+func (i *Informer) SetEventRecorder(recorder record.EventRecorder) {
+	i.recorder = recorder
+}
+
+// SetAddressTypes - Publish the first node address matching the types in order, before the informer is started
+func (i *Informer) SetAddressTypes(addressTypes []string) {
+	if len(addressTypes) > 0 {
+		i.addressTypes = addressTypes
+	}
+}
+
+// SetZoneLabel - Tell the zone of every host ip from the node label, before the informer is started
+func (i *Informer) SetZoneLabel(zoneLabel string) {
+	i.zoneLabel = zoneLabel
+}
+
+// SetWeightAnnotation - Tell the weight of every host ip from the node annotation, before the informer is started
+func (i *Informer) SetWeightAnnotation(weightAnnotation string) {
+	i.weightAnnotation = weightAnnotation
+}
+
+// nodeAddress - First address of the node matching the address types
+func (i *Informer) nodeAddress(node *v1Api.Node) (ipaddress string, ConditionReady bool, err error) {
+	return NodeAddress(node, i.addressTypes)
+}
+
+// NodeAddress - First address of the node matching the types in order of preference, DefaultAddressType without any
+func NodeAddress(node *v1Api.Node, addressTypes []string) (ipaddress string, ConditionReady bool, err error) {
+
+	if len(addressTypes) == 0 {
+		addressTypes = []string{DefaultAddressType}
+	}
+
+	for _, t := range addressTypes {
+		ipaddress, ConditionReady, err = GetNodeAddress(node, t)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// WaitForSync - Block until the initial listing is read, false if the informer gave up
+func (i *Informer) WaitForSync(ctx context.Context) bool {
+	select {
+	case <-i.synced:
+		return true
+	case <-i.errCloseChan:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ReadOnce - Run the informer just long enough to list the nodes, the host ips, zones and weights stay readable
+func ReadOnce(ctx context.Context, inf *Informer) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go inf.Start(ctx)
+
+	if !inf.WaitForSync(ctx) {
+		return fmt.Errorf("Could not list the nodes matching %q", inf.watchLabels)
+	}
+
+	return nil
+}
+
+// GetHostIPs - List all the IPs, waits for the initial listing when the informer was just started
+func (i *Informer) GetHostIPs(ctx context.Context) (hostips []string, err error) {
+	logging.LoggerV(logging.ComponentInformer, 2).Debug("Read host ips")
+
+	//The controller starts the informer and asks right away, an empty set would unpublish everything
+	if i.synced != nil {
+		select {
+		case <-i.synced:
+		case <-i.errCloseChan:
+			return nil, fmt.Errorf("Could not list the nodes matching %q", i.watchLabels)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	defer i.rwLock.Unlock()
+	i.rwLock.Lock()
+	return i.hostsIPs, nil
+}
+
+// GetHostZones - Zone of every host ip whose node carries the zone label, empty without SetZoneLabel
+func (i *Informer) GetHostZones(ctx context.Context) (map[string]string, error) {
+	i.rwLock.RLock()
+	defer i.rwLock.RUnlock()
+
+	zones := make(map[string]string, len(i.hostZones))
+	for ip, zone := range i.hostZones {
+		zones[ip] = zone
+	}
+	return zones, nil
+}
+
+// GetHostWeights - Weight of every host ip whose node carries a valid weight annotation, empty without SetWeightAnnotation
+func (i *Informer) GetHostWeights(ctx context.Context) (map[string]int, error) {
+	i.rwLock.RLock()
+	defer i.rwLock.RUnlock()
+
+	weights := make(map[string]int, len(i.hostWeights))
+	for ip, weight := range i.hostWeights {
+		weights[ip] = weight
+	}
+	return weights, nil
+}
+
+// GetNodeAddress - Return the node
+func GetNodeAddress(node *v1Api.Node, matchAddressType string) (ipaddress string, ConditionReady bool, err error) {
+
+	for _, conditions := range node.Status.Conditions {
+
+		if string(conditions.Type) == "Ready" {
+			if string(conditions.Status) == "True" {
+				//fmt.Println(address.Address)
+				ConditionReady = true
+			} else {
+				ConditionReady = false
+			}
+		}
+
+	}
+
+	for _, address := range node.Status.Addresses {
+
+		if string(address.Type) == matchAddressType {
+
+			ipaddress = string(address.Address)
+			return
+		}
+	}
+
+	return "", false, fmt.Errorf("Cannot locate IP Address Type: %s", matchAddressType)
+}
+
+// updateHostIPS - update the IPs to local var
+func (i *Informer) updateHostIPs() error {
+
+	nodes, err := i.lister.List(labels.Everything())
+
+	if err != nil {
+		return err
+	}
+
+	i.hostsIPs = []string{}
+	i.hostZones = map[string]string{}
+	i.hostWeights = map[string]int{}
+	ready := make(map[string]*v1Api.Node, len(nodes))
+
+	for _, node := range nodes {
+
+		nodeip, nodeisready, err := i.nodeAddress(node)
+		if err != nil {
+			//Nothing to publish for this one, the others are still good
+			logging.Logger(logging.ComponentInformer).Warn("Skipping node", zap.String("node", node.Name), zap.Error(err))
+			continue
+		}
+
+		if nodeisready {
+			i.hostsIPs = append(i.hostsIPs, nodeip)
+			ready[node.Name] = node
+
+			if zone := i.nodeZone(node); zone != "" {
+				i.hostZones[nodeip] = zone
+			}
+			if weight, ok := i.nodeWeight(node); ok {
+				i.hostWeights[nodeip] = weight
+			}
+		}
+
+	}
+
+	sort.Strings(i.hostsIPs) //Make sure IP is in ascending mode
+
+	//A node gone or unlabeled gets warned about again when it comes back with the same value
+	listed := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		listed[node.Name] = true
+	}
+	for name := range i.invalidWeights {
+		if !listed[name] {
+			delete(i.invalidWeights, name)
+		}
+	}
+
+	i.recordPublished(ready)
+
+	return nil
+}
+
+// nodeZone - Value of the zone label, empty when the zones are not published or the node has none
+func (i *Informer) nodeZone(node *v1Api.Node) string {
+	if i.zoneLabel == "" {
+		return ""
+	}
+	return node.Labels[i.zoneLabel]
+}
+
+// nodeWeight - Value of the weight annotation, false when the weights are not read or the node has no valid one
+func (i *Informer) nodeWeight(node *v1Api.Node) (int, bool) {
+
+	if i.weightAnnotation == "" {
+		return 0, false
+	}
+
+	val, ok := node.Annotations[i.weightAnnotation]
+	if !ok {
+		delete(i.invalidWeights, node.Name)
+		return 0, false
+	}
+
+	weight, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil || weight < 1 || weight > maxWeight {
+		i.warnInvalidWeight(node, val)
+		return 0, false
+	}
+
+	delete(i.invalidWeights, node.Name)
+	return weight, true
+}
+
+// warnInvalidWeight - Warn and emit an event the first time a node has this invalid weight, the node updates
+// and the rebuilds after that only log at V(2)
+func (i *Informer) warnInvalidWeight(node *v1Api.Node, val string) {
+
+	if last, ok := i.invalidWeights[node.Name]; ok && last == val {
+		logging.LoggerV(logging.ComponentInformer, 2).Debug("Ignoring the weight annotation",
+			zap.String("node", node.Name), zap.String("annotation", i.weightAnnotation), zap.String("value", val))
+		return
+	}
+	i.invalidWeights[node.Name] = val
+
+	logging.Logger(logging.ComponentInformer).Warn("Ignoring the weight annotation, it must be a number between 1 and 65535",
+		zap.String("node", node.Name), zap.String("annotation", i.weightAnnotation), zap.String("value", val))
+	if i.recorder != nil {
+		i.recorder.Eventf(node, v1Api.EventTypeWarning, ReasonInvalidWeight, "Weight annotation %s=%q ignored, it must be a number between 1 and 65535", i.weightAnnotation, val)
+	}
+}
+
+// recordPublished - Log and emit the events for the nodes joining or leaving the published set
+func (i *Informer) recordPublished(ready map[string]*v1Api.Node) {
+
+	for name, node := range ready {
+		if _, ok := i.published[name]; !ok {
+			nodeip, _, _ := i.nodeAddress(node)
+			logging.Logger(logging.ComponentInformer).Info("Node added to the published set", zap.String("node", name), zap.String("ip", nodeip))
+			if i.recorder != nil {
+				i.recorder.Eventf(node, v1Api.EventTypeNormal, ReasonNodePublished, "Node address %s added to the published set", nodeip)
+			}
+		}
+	}
+
+	//The node may be gone already, the last seen copy is still good to refer to
+	for name, node := range i.published {
+		if _, ok := ready[name]; !ok {
+			nodeip, _, _ := i.nodeAddress(node)
+			logging.Logger(logging.ComponentInformer).Info("Node removed from the published set", zap.String("node", name), zap.String("ip", nodeip))
+			if i.recorder != nil {
+				i.recorder.Eventf(node, v1Api.EventTypeNormal, ReasonNodeUnpublished, "Node address %s removed from the published set", nodeip)
+			}
+		}
+	}
+
+	i.published = ready
+}
+
+// GetInformerInterupt - Provide the downstream api a notify that there was a change
+func (i *Informer) GetInformerInterupt() chan struct{} {
+	return i.updateHostIPsChan
+}
+
+// GetInformerErrorClose - Provide upstream that the informer can no longer proceed
+func (i *Informer) GetInformerErrorClose() chan struct{} {
+	return i.errCloseChan
+}
+
+// Start - connect the kubernetes master
+func (i *Informer) Start(ctx context.Context) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logHandledErrors()
+
+	if i.clientset == nil {
+		panic("Client is not properly setup")
+	}
+
+	//List and watch through our own functions, the failures of this informer are counted here and nowhere else
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metaV1.ListOptions) (runtimeApi.Object, error) {
+			options.LabelSelector = i.watchLabels
+			list, err := i.clientset.CoreV1().Nodes().List(options)
+			i.watchFailed(err, cancel)
+			return list, err
+		},
+		WatchFunc: func(options metaV1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = i.watchLabels
+			w, err := i.clientset.CoreV1().Nodes().Watch(options)
+			i.watchFailed(err, cancel)
+			return w, err
+		},
+	}
+
+	nodeInformer := cache.NewSharedIndexInformer(listWatch, &v1Api.Node{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	i.indexer = nodeInformer.GetIndexer()
+	i.lister = v1.NewNodeLister(i.indexer)
+
+	nodeInformer.AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+
+				key, err := cache.MetaNamespaceKeyFunc(obj)
+				if err == nil && nodeInformer.HasSynced() {
+					logging.LoggerV(logging.ComponentInformer, 2).Debug("Node added", zap.String("node", key))
+					i.queue.Add(key)
+				}
+			},
+			UpdateFunc: func(oldobj, newObj interface{}) {
+
+				key, err := cache.MetaNamespaceKeyFunc(newObj)
+				//key2, _ := cache.DeletionHandlingMetaNamespaceKeyFunc(oldobj)
+				if err == nil && nodeInformer.HasSynced() {
+					logging.LoggerV(logging.ComponentInformer, 2).Debug("Node updated", zap.String("node", key))
+					i.queue.Add(key)
+				}
+
+			},
+			DeleteFunc: func(obj interface{}) {
+				key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				if err == nil && nodeInformer.HasSynced() {
+					logging.LoggerV(logging.ComponentInformer, 2).Debug("Node deleted", zap.String("node", key))
+					i.queue.Add(key)
+				}
+			},
+		})
+
+	go nodeInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), nodeInformer.HasSynced) {
+		runtime.HandleError(fmt.Errorf("Timed out waiting for caches to sync"))
+		i.giveUp()
+		return
+	}
+
+	//Attemp to do the initial update
+	i.rwLock.Lock()
+	err := i.updateHostIPs()
+	i.rwLock.Unlock()
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("Lister could not be read"))
+		i.giveUp()
+		return
+	}
+	if i.synced != nil {
+		close(i.synced) //Now the downstream can read the first listing
+	}
+
+	logging.Logger(logging.ComponentInformer).Info("Cache is synced", zap.Strings("ips", i.hostsIPs))
+
+	threadiness := 1
+
+	for j := 0; j < threadiness; j++ {
+		go clockutil.Until(clockutil.OrDefault(i.clock), i.runWorker, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+	logging.Logger(logging.ComponentInformer).Info("Stop informer")
+
+}
+
+// watchFailed - Count the consecutive failures of the list and watch calls, give up after maxWatchFailures
+func (i *Informer) watchFailed(err error, cancel context.CancelFunc) {
+
+	if err == nil {
+		i.errorCount = 0
+		return
+	}
+
+	i.errorCount++
+	logging.Logger(logging.ComponentInformer).Info("Informer error", zap.Int("errorCount", i.errorCount), zap.Error(err))
+
+	if i.errorCount >= maxWatchFailures {
+		logging.Logger(logging.ComponentInformer).Error("Terminating due to error", zap.Int("errorCount", i.errorCount))
+		cancel()
+		i.giveUp()
+	}
+}
+
+// giveUp - Trigger up chain that the informer can no longer proceed, never blocks and can be called more than once
+func (i *Informer) giveUp() {
+	i.errCloseOnce.Do(func() { close(i.errCloseChan) })
+}
+
+func (i *Informer) runWorker() {
+	for i.processNextItem() {
+	}
+}
+
+func (i *Informer) processNextItem() bool {
+
+	logging.LoggerV(logging.ComponentInformer, 2).Debug("Process next item")
+
+	// Wait until there is a new item in the working queue
+	key, quit := i.queue.Get()
+
+	if quit {
+		return false
+	}
+	// Tell the queue that we are done with processing this key. This unblocks the key for other workers
+	// This allows safe parallel processing because two pods with the same key are never processed in
+	// parallel.
+	defer i.queue.Done(key)
+
+	obj, exists, err := i.indexer.GetByKey(key.(string))
+
+	if err != nil {
+		logging.Logger(logging.ComponentInformer).Error("Fetching object from store failed", zap.String("node", key.(string)), zap.Error(err))
+	}
+
+	if !exists {
+		//There is a deletion that just happened
+		i.rwLock.Lock()
+		err := i.updateHostIPs()
+		i.rwLock.Unlock()
+		if err != nil {
+			runtime.HandleError(fmt.Errorf("Lister could not be read"))
+			return false
+		}
+
+		logging.LoggerV(logging.ComponentInformer, 2).Debug("Got host ips", zap.Strings("ips", i.hostsIPs))
+
+		i.updateHostIPsChan <- struct{}{} //Notify downstream to start reacting
+
+	} else {
+		//Could be Add/Sync/Update
+		hostsIPsStr := fmt.Sprintf("%q", i.hostsIPs)
+
+		node := obj.(*v1Api.Node)
+		nodeIP, nodeisready, err2 := i.nodeAddress(node)
+		if err != nil {
+			panic(err2)
+		}
+
+		existInHostsIPsList := strings.Contains(hostsIPsStr, nodeIP)
+
+		//A node moved to another zone is published under another name, a new weight changes the entry
+		zoneChanged := nodeisready && i.nodeZone(node) != i.hostZones[nodeIP]
+		weight, _ := i.nodeWeight(node)
+		weightChanged := nodeisready && weight != i.hostWeights[nodeIP]
+
+		if (nodeisready && !existInHostsIPsList) || (!nodeisready && existInHostsIPsList) || zoneChanged || weightChanged {
+
+			i.rwLock.Lock()
+			err := i.updateHostIPs()
+			i.rwLock.Unlock()
+			if err != nil {
+				runtime.HandleError(fmt.Errorf("Lister could not be read"))
+				return false
+			}
+
+			logging.LoggerV(logging.ComponentInformer, 2).Debug("Got host ips", zap.Strings("ips", i.hostsIPs))
+			i.updateHostIPsChan <- struct{}{} //Notify downstream to start reacting
+		}
+
+	}
+
+	return true
+}
@@ -1,4 +1,4 @@
-package main
+package source
 
 import (
 	"context"
@@ -6,17 +6,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/tweakmy/fotofona/internal/testutil"
 	v1 "k8s.io/api/core/v1"
-	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/workqueue"
 )
 
 type clientops struct {
@@ -51,8 +53,8 @@ func TestInformerCrud(t *testing.T) {
 	flag.Set("alsologtostderr", fmt.Sprintf("%t", true))
 	flag.Set("v", "2")
 
-	node1 := newMasterNode("node1", "10.0.0.1", "True")
-	node2 := newMasterNode("node2", "10.0.0.3", "True")
+	node1 := testutil.NewMasterNode("node1", "10.0.0.1", "True")
+	node2 := testutil.NewMasterNode("node2", "10.0.0.3", "True")
 
 	var TestCondition = tddInformerCond{
 		watchLabel: "node-role.kubernetes.io/master=",
@@ -62,7 +64,7 @@ func TestInformerCrud(t *testing.T) {
 
 		clientops: []clientops{
 			clientops{addOrdelOrUpdate: "NONE", whatNode: nil},
-			clientops{addOrdelOrUpdate: "ADD", whatNode: newMasterNode("node3", "10.0.0.2", "True")},
+			clientops{addOrdelOrUpdate: "ADD", whatNode: testutil.NewMasterNode("node3", "10.0.0.2", "True")},
 			clientops{addOrdelOrUpdate: "DELETE", whatNode: node1},
 			clientops{addOrdelOrUpdate: "UPDATEFALSE", whatNode: node2},
 		},
@@ -88,21 +90,30 @@ func TestInformerCrud(t *testing.T) {
 	// Create the fake client.
 	fakeClient := fake.NewSimpleClientset(nodes...)
 
-	inf := Informer{
-		clientset:         fakeClient,
-		updateHostIPsChan: make(chan struct{}),
-		queue:             workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		watchLabels:       TestCondition.watchLabel,
-	}
+	//A change made before the informer watches would never be notified
+	watching := make(chan struct{})
+	var watchOnce sync.Once
+	trackerWatch := fakeClient.WatchReactionChain[0]
+	fakeClient.PrependWatchReactor("nodes", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		handled, w, err := trackerWatch.React(action)
+		watchOnce.Do(func() { close(watching) })
+		return handled, w, err
+	})
+
+	inf := NewInformer(TestCondition.watchLabel, fakeClient)
 	sigChan := inf.GetInformerInterupt()
 
 	//Start the informer to read data
 	go inf.Start(ctx)
 
+	select {
+	case <-watching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the informer to watch the nodes")
+	}
+
 forloop:
 	for i, op := range TestCondition.clientops {
-		time.Sleep(time.Second)
-		//time.Sleep(time.Second) //sleep 1 second
 		fmt.Printf("Evaluating test informer case %d\n", i)
 
 		switch op.addOrdelOrUpdate {
@@ -194,29 +205,3 @@ func SetupClient(useKubeConfig bool, i *Informer) {
 
 	i.clientset = clientset
 }
-
-// newMasterNode - helper function to create node
-func newMasterNode(nodeName string, ipaddress string, statusphase string) *v1.Node {
-	return &v1.Node{
-		ObjectMeta: metaV1.ObjectMeta{
-			Name: nodeName,
-			Labels: map[string]string{
-				"node-role.kubernetes.io/master": "",
-			},
-		},
-		Status: v1.NodeStatus{
-			Conditions: []v1.NodeCondition{
-				v1.NodeCondition{
-					Type:   v1.NodeConditionType("Ready"),
-					Status: v1.ConditionStatus(statusphase),
-				},
-			},
-			Addresses: []v1.NodeAddress{
-				v1.NodeAddress{
-					Type:    v1.NodeAddressType("InternalIP"),
-					Address: ipaddress,
-				},
-			},
-		},
-	}
-}
@@ -0,0 +1,185 @@
+package source
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Defaults of the probe, see --probe-timeout and --probe-interval
+const (
+	DefaultProbeTimeout  = 2 * time.Second
+	DefaultProbeInterval = 10 * time.Second
+)
+
+// Prober - Only the host ips of the source accepting a tcp connection on the port are published
+// When none of them does, all of them are published rather than none
+type Prober struct {
+	source HostSource
+	port   int
+
+	timeout  time.Duration
+	interval time.Duration
+	clock    clock.Clock
+
+	//What the controller was given last, a probe coming to another result signals it
+	mu        sync.Mutex
+	published []string
+
+	updateHostIPsChan chan struct{}
+}
+
+// NewProber - Probe the host ips of the source on the port
+func NewProber(source HostSource, port int) *Prober {
+	return &Prober{
+		source:            source,
+		port:              port,
+		timeout:           DefaultProbeTimeout,
+		interval:          DefaultProbeInterval,
+		clock:             clockutil.Default,
+		updateHostIPsChan: make(chan struct{}, 1),
+	}
+}
+
+// SetTimeout - Bound of every connection attempt, before the prober is started
+func (p *Prober) SetTimeout(timeout time.Duration) {
+	p.timeout = timeout
+}
+
+// SetInterval - Probe the host ips again every interval, before the prober is started
+func (p *Prober) SetInterval(interval time.Duration) {
+	p.interval = interval
+}
+
+// SetClock - Time the probes on the clock instead of the real one, before the prober is started
+func (p *Prober) SetClock(clk clock.Clock) {
+	p.clock = clk
+}
+
+// Start - Start the source and probe its host ips every interval until the context is done
+func (p *Prober) Start(ctx context.Context) {
+
+	go p.source.Start(ctx)
+
+	go func() {
+		for {
+			select {
+			case <-p.source.GetInformerInterupt():
+				signal(p.updateHostIPsChan)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	clockutil.Until(clockutil.OrDefault(p.clock), func() { p.reprobe(ctx) }, p.interval, ctx.Done())
+}
+
+// GetHostIPs - The host ips of the source passing the probe
+func (p *Prober) GetHostIPs(ctx context.Context) ([]string, error) {
+
+	ips, err := p.source.GetHostIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	healthy := p.probe(ctx, ips)
+
+	p.mu.Lock()
+	p.published = healthy
+	p.mu.Unlock()
+
+	return healthy, nil
+}
+
+// GetHostZones - Zone of the host ips when the source tells them
+func (p *Prober) GetHostZones(ctx context.Context) (map[string]string, error) {
+	if zs, ok := p.source.(zoneSource); ok {
+		return zs.GetHostZones(ctx)
+	}
+	return map[string]string{}, nil
+}
+
+// GetHostWeights - Weight of the host ips when the source tells them
+func (p *Prober) GetHostWeights(ctx context.Context) (map[string]int, error) {
+	if ws, ok := p.source.(weightSource); ok {
+		return ws.GetHostWeights(ctx)
+	}
+	return map[string]int{}, nil
+}
+
+// GetInformerInterupt - Signals when the source changed or a host ip passed or failed the probe
+func (p *Prober) GetInformerInterupt() chan struct{} {
+	return p.updateHostIPsChan
+}
+
+// GetInformerErrorClose - Signals when the source gave up
+func (p *Prober) GetInformerErrorClose() chan struct{} {
+	return p.source.GetInformerErrorClose()
+}
+
+// reprobe - Signal the controller when the probe no longer agrees with what it published
+func (p *Prober) reprobe(ctx context.Context) {
+
+	ips, err := p.source.GetHostIPs(ctx)
+	if err != nil {
+		return
+	}
+
+	healthy := p.probe(ctx, ips)
+
+	p.mu.Lock()
+	changed := !reflect.DeepEqual(healthy, p.published)
+	p.mu.Unlock()
+
+	if changed {
+		logging.Logger(logging.ComponentInformer).Info("Probed host ips changed", zap.Strings("ips", healthy))
+		signal(p.updateHostIPsChan)
+	}
+}
+
+// probe - The host ips accepting a connection in their order, all of them when none does
+func (p *Prober) probe(ctx context.Context, ips []string) []string {
+
+	ok := make([]bool, len(ips))
+
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+
+			dialer := net.Dialer{Timeout: p.timeout}
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(p.port)))
+			if err != nil {
+				logging.LoggerV(logging.ComponentInformer, 2).Debug("Probe failed", zap.String("ip", ip), zap.Int("port", p.port), zap.Error(err))
+				return
+			}
+			conn.Close()
+			ok[i] = true
+		}(i, ip)
+	}
+	wg.Wait()
+
+	healthy := []string{}
+	for i, ip := range ips {
+		if ok[i] {
+			healthy = append(healthy, ip)
+		}
+	}
+
+	if len(healthy) == 0 && len(ips) > 0 {
+		logging.Logger(logging.ComponentInformer).Warn("No host ip passed the probe, publishing all of them", zap.Strings("ips", ips), zap.Int("port", p.port))
+		return ips
+	}
+
+	return healthy
+}
@@ -0,0 +1,57 @@
+package source
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/testutil"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Verify only the listening host ips are published, and all of them when none listens
+func TestProber(t *testing.T) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	//127.0.0.2 is loopback too but nothing listens there
+	st := NewStatic([]string{"127.0.0.2", "127.0.0.1"})
+
+	clk := clock.NewFakeClock(time.Now())
+	prober := NewProber(st, port)
+	prober.SetClock(clk)
+	prober.SetTimeout(time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ips, err := prober.GetHostIPs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ips, []string{"127.0.0.1"}) {
+		t.Errorf("Expected only the listening ip but got %v", ips)
+	}
+
+	go prober.Start(ctx)
+
+	l.Close()
+	testutil.WaitFor(t, "the next probe", clk.HasWaiters)
+	clk.Step(DefaultProbeInterval)
+
+	select {
+	case <-prober.GetInformerInterupt():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the failed probe to be signaled")
+	}
+
+	if ips, _ := prober.GetHostIPs(ctx); !reflect.DeepEqual(ips, []string{"127.0.0.2", "127.0.0.1"}) {
+		t.Errorf("Expected every ip when none passes but got %v", ips)
+	}
+}
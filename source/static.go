@@ -0,0 +1,235 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/clockutil"
+	"github.com/tweakmy/fotofona/logging"
+	"go.uber.org/zap"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultStaticRefresh - How often the file and the ConfigMap are read again
+const DefaultStaticRefresh = 30 * time.Second
+
+// DefaultConfigMapKey - Key of the ConfigMap holding the ips
+const DefaultConfigMapKey = "ips"
+
+// Static - Host ips which are not kubernetes nodes, from a list, a file and a ConfigMap together
+// The file and the ConfigMap hold ips separated by spaces, commas or new lines, # starts a comment
+type Static struct {
+	ips []string
+
+	file string
+
+	clientset    kubernetes.Interface
+	cmNamespace  string
+	cmName       string
+	configMapKey string
+
+	refresh time.Duration
+	clock   clock.Clock
+
+	//The first read happens with the first GetHostIPs, the controller does not wait for Start
+	loadOnce sync.Once
+	mu       sync.Mutex
+	hostIPs  []string
+	loaded   bool
+
+	//Last good read of each origin, a failed read keeps it
+	fromFile      []string
+	fromConfigMap []string
+
+	updateHostIPsChan chan struct{}
+	errCloseChan      chan struct{}
+}
+
+// NewStatic - Always publish the ips, more are read once SetFile or SetConfigMap are called
+func NewStatic(ips []string) *Static {
+	return &Static{
+		ips:               ips,
+		configMapKey:      DefaultConfigMapKey,
+		refresh:           DefaultStaticRefresh,
+		clock:             clockutil.Default,
+		updateHostIPsChan: make(chan struct{}, 1),
+		errCloseChan:      make(chan struct{}),
+	}
+}
+
+// SetFile - Read the ips from the file too, before the source is started
+func (s *Static) SetFile(path string) {
+	s.file = path
+}
+
+// SetConfigMap - Read the ips from the key of the ConfigMap too, before the source is started
+func (s *Static) SetConfigMap(clientset kubernetes.Interface, namespace string, name string, key string) {
+	s.clientset = clientset
+	s.cmNamespace = namespace
+	s.cmName = name
+	if key != "" {
+		s.configMapKey = key
+	}
+}
+
+// SetRefresh - Read the file and the ConfigMap again every period, before the source is started
+func (s *Static) SetRefresh(period time.Duration) {
+	s.refresh = period
+}
+
+// SetClock - Time the refresh on the clock instead of the real one, before the source is started
+func (s *Static) SetClock(clk clock.Clock) {
+	s.clock = clk
+}
+
+// ParseIPs - Ips separated by spaces, commas or new lines, a # starts a comment until the end of the line
+func ParseIPs(text string) ([]string, error) {
+
+	var ips []string
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' }) {
+			if net.ParseIP(field) == nil {
+				return nil, fmt.Errorf("%q is not an ip address", field)
+			}
+			ips = append(ips, field)
+		}
+	}
+
+	return ips, nil
+}
+
+// Start - Read the file and the ConfigMap again every refresh until the context is done
+func (s *Static) Start(ctx context.Context) {
+
+	s.loadOnce.Do(s.reload)
+
+	if s.file == "" && s.clientset == nil {
+		<-ctx.Done()
+		return
+	}
+
+	clockutil.Until(clockutil.OrDefault(s.clock), s.reload, s.refresh, ctx.Done())
+}
+
+// GetHostIPs - The ips of the list, the file and the ConfigMap in that order, without duplicates
+func (s *Static) GetHostIPs(ctx context.Context) ([]string, error) {
+
+	s.loadOnce.Do(s.reload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hostIPs, nil
+}
+
+// GetInformerInterupt - Signals when the ips read from the file or the ConfigMap changed
+func (s *Static) GetInformerInterupt() chan struct{} {
+	return s.updateHostIPsChan
+}
+
+// GetInformerErrorClose - Never closes, a failed read keeps the previous ips of that origin
+func (s *Static) GetInformerErrorClose() chan struct{} {
+	return s.errCloseChan
+}
+
+// reload - Read every origin again and signal when the ips changed, a failed origin keeps its previous ips
+func (s *Static) reload() {
+
+	log := logging.Logger(logging.ComponentInformer)
+
+	//The list is always there, even when the file or the ConfigMap never could be read
+	if s.file != "" {
+		if ips, err := s.readFile(); err != nil {
+			log.Error("Could not read the static ips of the file, keeping the previous ones", zap.Error(err))
+		} else {
+			s.fromFile = ips
+		}
+	}
+
+	if s.clientset != nil {
+		if ips, err := s.readConfigMap(); err != nil {
+			log.Error("Could not read the static ips of the configmap, keeping the previous ones", zap.Error(err))
+		} else {
+			s.fromConfigMap = ips
+		}
+	}
+
+	ips := append(append(append([]string{}, s.ips...), s.fromFile...), s.fromConfigMap...)
+	ips = uniqueIPs(ips)
+
+	//The first read is what the controller publishes to begin with, nothing to signal
+	s.mu.Lock()
+	changed := s.loaded && !reflect.DeepEqual(ips, s.hostIPs)
+	s.hostIPs = ips
+	s.loaded = true
+	s.mu.Unlock()
+
+	if changed {
+		log.Info("Static ips changed", zap.Strings("ips", ips))
+		signal(s.updateHostIPsChan)
+	}
+}
+
+// readFile - The ips of the file
+func (s *Static) readFile() ([]string, error) {
+
+	b, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := ParseIPs(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", s.file, err.Error())
+	}
+	return ips, nil
+}
+
+// readConfigMap - The ips of the key of the ConfigMap
+func (s *Static) readConfigMap() ([]string, error) {
+
+	cm, err := s.clientset.CoreV1().ConfigMaps(s.cmNamespace).Get(s.cmName, metaV1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := ParseIPs(cm.Data[s.configMapKey])
+	if err != nil {
+		return nil, fmt.Errorf("configmap %s/%s: %s", s.cmNamespace, s.cmName, err.Error())
+	}
+	return ips, nil
+}
+
+// uniqueIPs - Drop the repeated ips, keeping the first position of each
+func uniqueIPs(ips []string) []string {
+
+	seen := make(map[string]bool, len(ips))
+	unique := []string{}
+	for _, ip := range ips {
+		if !seen[ip] {
+			seen[ip] = true
+			unique = append(unique, ip)
+		}
+	}
+
+	return unique
+}
+
+// signal - Notify the controller without blocking, one pending signal is enough
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
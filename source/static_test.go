@@ -0,0 +1,159 @@
+package source
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tweakmy/fotofona/internal/testutil"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseIPs(t *testing.T) {
+
+	ips, err := ParseIPs("10.0.0.1, 10.0.0.2\n# vip\n10.0.0.3 fd00::1 # external etcd\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "fd00::1"}
+	if !reflect.DeepEqual(ips, expected) {
+		t.Errorf("Expected %v but got %v", expected, ips)
+	}
+
+	if _, err := ParseIPs("10.0.0.1 master-1"); err == nil {
+		t.Error("Expected a host name to be rejected")
+	}
+}
+
+// Verify the file is read again and a change is signaled, a broken file keeps the previous ips
+func TestStaticFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "fotofona-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "ips")
+	if err := ioutil.WriteFile(file, []byte("10.0.0.2\n10.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clk := clock.NewFakeClock(time.Now())
+	st := NewStatic([]string{"10.0.0.1"})
+	st.SetFile(file)
+	st.SetClock(clk)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if ips, _ := st.GetHostIPs(ctx); !reflect.DeepEqual(ips, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expected the flag then the file without duplicates but got %v", ips)
+	}
+
+	go st.Start(ctx)
+
+	if err := ioutil.WriteFile(file, []byte("not an ip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitFor(t, "the refresh", clk.HasWaiters)
+	clk.Step(DefaultStaticRefresh)
+	testutil.WaitFor(t, "the refresh", clk.HasWaiters)
+
+	select {
+	case <-st.GetInformerInterupt():
+		t.Error("Unexpected change signaled for a broken file")
+	default:
+	}
+	if ips, _ := st.GetHostIPs(ctx); !reflect.DeepEqual(ips, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expected the previous ips to be kept but got %v", ips)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("10.0.0.3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	clk.Step(DefaultStaticRefresh)
+
+	select {
+	case <-st.GetInformerInterupt():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the change to be signaled")
+	}
+	if ips, _ := st.GetHostIPs(ctx); !reflect.DeepEqual(ips, []string{"10.0.0.1", "10.0.0.3"}) {
+		t.Errorf("Expected the new file to be read but got %v", ips)
+	}
+}
+
+func TestStaticConfigMap(t *testing.T) {
+
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "kube-system", Name: "fotofona-static"},
+		Data:       map[string]string{"masters": "192.168.0.10,192.168.0.11"},
+	})
+
+	st := NewStatic(nil)
+	st.SetConfigMap(clientset, "kube-system", "fotofona-static", "masters")
+
+	ips, err := st.GetHostIPs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"192.168.0.10", "192.168.0.11"}; !reflect.DeepEqual(ips, expected) {
+		t.Errorf("Expected %v but got %v", expected, ips)
+	}
+}
+
+// Verify an origin failing from the start leaves the list and the other origins published
+func TestStaticPartialRead(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "fotofona-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "kube-system", Name: "fotofona-static"},
+		Data:       map[string]string{DefaultConfigMapKey: "192.168.0.10"},
+	})
+
+	//The file is not there yet
+	file := filepath.Join(dir, "ips")
+	clk := clock.NewFakeClock(time.Now())
+	st := NewStatic([]string{"10.0.0.1"})
+	st.SetFile(file)
+	st.SetConfigMap(clientset, "kube-system", "fotofona-static", "")
+	st.SetClock(clk)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if ips, _ := st.GetHostIPs(ctx); !reflect.DeepEqual(ips, []string{"10.0.0.1", "192.168.0.10"}) {
+		t.Errorf("Expected the flag and the configmap without the file but got %v", ips)
+	}
+
+	go st.Start(ctx)
+
+	if err := ioutil.WriteFile(file, []byte("10.0.0.2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitFor(t, "the refresh", clk.HasWaiters)
+	clk.Step(DefaultStaticRefresh)
+
+	select {
+	case <-st.GetInformerInterupt():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the file showing up to be signaled")
+	}
+	if ips, _ := st.GetHostIPs(ctx); !reflect.DeepEqual(ips, []string{"10.0.0.1", "10.0.0.2", "192.168.0.10"}) {
+		t.Errorf("Expected every origin but got %v", ips)
+	}
+}